@@ -0,0 +1,212 @@
+// Package archive は受信した電文をそのまま保存する
+//
+// 保存先は次のようになる。dirごとnamazu replayで流し直せる。replayはenvelopeから種別とhead.testを戻す
+//
+//	<dir>/2011/03/11/20110311T144810_VXSE45_<id>.xml            デコードした電文（JSON形式なら.json）
+//	<dir>/2011/03/11/20110311T144810_VXSE45_<id>_1.xml          zipに含まれた2つ目以降の電文
+//	<dir>/2011/03/11/20110311T144810_VXSE45_<id>.envelope.json  WebSocketのdataメッセージ（bodyは除く）
+//	<dir>/events/<EventID>.jsonl                                EventIDごとの索引
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/matsuu/namazu/eew"
+)
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+// EnvelopeSuffix はdataメッセージを保存するファイルの接尾辞
+const EnvelopeSuffix = ".envelope.json"
+
+// Entry は索引の1行
+type Entry struct {
+	// 受信した時刻
+	Time     time.Time `json:"time"`
+	Id       string    `json:"id"`
+	Type     string    `json:"type"`
+	EventId  string    `json:"eventId"`
+	Serial   int       `json:"serial,omitempty"`
+	InfoType string    `json:"infoType,omitempty"`
+	Test     bool      `json:"test,omitempty"`
+	// dirからの相対パス
+	Body     string `json:"body,omitempty"`
+	Envelope string `json:"envelope"`
+}
+
+// Archive はeew.Archiverの実装
+type Archive struct {
+	dir string
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+func New(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Archive{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+// head は電文から索引に必要な値を取り出す
+func head(body []byte, e *Entry) error {
+	if eew.IsJSON(body) {
+		var h struct {
+			EventId  string `json:"eventId"`
+			InfoType string `json:"infoType"`
+			SerialNo string `json:"serialNo"`
+		}
+		if err := json.Unmarshal(body, &h); err != nil {
+			return err
+		}
+		e.EventId = h.EventId
+		e.InfoType = h.InfoType
+		e.Serial, _ = strconv.Atoi(h.SerialNo)
+		return nil
+	}
+
+	doc, err := xmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	root := xmlquery.FindOne(doc, "//Report")
+	if root == nil {
+		return fmt.Errorf("no Report element")
+	}
+	if n := root.SelectElement("//Head/EventID"); n != nil {
+		e.EventId = n.InnerText()
+	}
+	if n := root.SelectElement("//Head/InfoType"); n != nil {
+		e.InfoType = n.InnerText()
+	}
+	if n := root.SelectElement("//Head/Serial"); n != nil {
+		e.Serial, _ = strconv.Atoi(n.InnerText())
+	}
+	return nil
+}
+
+func (a *Archive) Archive(data *eew.WebsocketData, bodies [][]byte) error {
+	t := data.Head.Time
+	if t.IsZero() {
+		t = a.now()
+	}
+	t = t.In(jst)
+	typ := data.Head.Type
+	if typ == "" {
+		typ = "UNKNOWN"
+	}
+	day := filepath.Join(t.Format("2006"), t.Format("01"), t.Format("02"))
+	base := filepath.Join(day, fmt.Sprintf("%s_%s_%s", t.Format("20060102T150405"), typ, data.Id))
+	ext := ".xml"
+	if data.Format != nil && *data.Format == "json" {
+		ext = ".json"
+	}
+
+	if err := os.MkdirAll(filepath.Join(a.dir, day), 0o755); err != nil {
+		return err
+	}
+
+	envelope := *data
+	if len(bodies) > 0 {
+		// 電文は別に保存するので重複させない
+		envelope.Body = ""
+	}
+	j, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(a.dir, base+EnvelopeSuffix), j, 0o644); err != nil {
+		return err
+	}
+
+	e := Entry{
+		Time:     t,
+		Id:       data.Id,
+		Type:     data.Head.Type,
+		Test:     data.Head.Test,
+		Envelope: base + EnvelopeSuffix,
+	}
+	if len(bodies) == 0 {
+		// デコードできなかったものもunknownとして索引に残す
+		return a.index("unknown", e)
+	}
+	for i, body := range bodies {
+		e := e
+		// zipに複数の電文が含まれる場合は連番をつける
+		e.Body = base + ext
+		if i > 0 {
+			e.Body = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+		if err := os.WriteFile(filepath.Join(a.dir, e.Body), body, 0o644); err != nil {
+			return err
+		}
+		eventId := "unknown"
+		if err := head(body, &e); err == nil && e.EventId != "" {
+			eventId = e.EventId
+		}
+		if err := a.index(eventId, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) index(eventId string, e Entry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dir := filepath.Join(a.dir, "events")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, filepath.Base(eventId)+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Lookup はEventIDの電文を受信順に返す
+func (a *Archive) Lookup(eventId string) ([]Entry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	b, err := os.ReadFile(filepath.Join(a.dir, "events", filepath.Base(eventId)+".jsonl"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []Entry
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Path はEntryのファイルの絶対パス
+func (a *Archive) Path(rel string) string {
+	return filepath.Join(a.dir, rel)
+}
@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+func TestArchive(t *testing.T) {
+	body, err := os.ReadFile("../eew/samples/77_01_01_110311_VXSE45.xml")
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	a, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+
+	var data eew.WebsocketData
+	data.Type = "data"
+	data.Id = "abc"
+	data.Head.Type = "VXSE45"
+	data.Head.Time = time.Date(2011, 3, 11, 5, 48, 10, 0, time.UTC)
+	data.Body = "encoded"
+	if err := a.Archive(&data, [][]byte{body}); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+
+	entries, err := a.Lookup("20110311144640")
+	if err != nil {
+		t.Fatalf("failed to lookup: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("entries got:%d want:1", len(entries))
+	}
+	e := entries[0]
+	if got, want := e.Body, "2011/03/11/20110311T144810_VXSE45_abc.xml"; got != want {
+		t.Errorf("xml got:%s want:%s", got, want)
+	}
+	if e.Serial != 23 || e.InfoType != "発表" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if got, _ := os.ReadFile(a.Path(e.Body)); !bytes.Equal(got, body) {
+		t.Errorf("archived xml is not equal")
+	}
+	var envelope eew.WebsocketData
+	b, _ := os.ReadFile(a.Path(e.Envelope))
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal envelope: %v", err)
+	}
+	if envelope.Id != "abc" || envelope.Body != "" {
+		t.Errorf("unexpected envelope: %+v", envelope)
+	}
+}
+
+func TestArchiveJSON(t *testing.T) {
+	body, err := os.ReadFile("../eew/samples/77_01_01_110311_VXSE45.json")
+	if err != nil {
+		t.Fatalf("failed to open sample json: %v", err)
+	}
+	a, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+
+	format := "json"
+	var data eew.WebsocketData
+	data.Id = "abc"
+	data.Format = &format
+	data.Head.Type = "VXSE45"
+	data.Head.Time = time.Date(2011, 3, 11, 5, 48, 10, 0, time.UTC)
+	data.Head.Test = true
+	if err := a.Archive(&data, [][]byte{body}); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+
+	entries, _ := a.Lookup("20110311144640")
+	if len(entries) != 1 {
+		t.Fatalf("entries got:%d want:1", len(entries))
+	}
+	e := entries[0]
+	if got, want := e.Body, "2011/03/11/20110311T144810_VXSE45_abc.json"; got != want {
+		t.Errorf("json got:%s want:%s", got, want)
+	}
+	if got, want := e.Envelope, "2011/03/11/20110311T144810_VXSE45_abc"+EnvelopeSuffix; got != want {
+		t.Errorf("envelope got:%s want:%s", got, want)
+	}
+	if e.Serial != 23 || !e.Test {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	// replayが形式と訓練報の印を戻せるようにenvelopeに残す
+	var envelope eew.WebsocketData
+	b, _ := os.ReadFile(a.Path(e.Envelope))
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		t.Fatalf("failed to unmarshal envelope: %v", err)
+	}
+	if envelope.Format == nil || *envelope.Format != "json" || !envelope.Head.Test || envelope.Head.Type != "VXSE45" {
+		t.Errorf("unexpected envelope: %+v", envelope)
+	}
+}
+
+func TestArchiveUndecodable(t *testing.T) {
+	a, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	var data eew.WebsocketData
+	data.Id = "broken"
+	data.Body = "!!!"
+	if err := a.Archive(&data, nil); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	entries, _ := a.Lookup("unknown")
+	if len(entries) != 1 || entries[0].Body != "" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	var envelope eew.WebsocketData
+	b, _ := os.ReadFile(a.Path(entries[0].Envelope))
+	json.Unmarshal(b, &envelope)
+	// デコードできなかったものはbodyを残す
+	if envelope.Body != "!!!" {
+		t.Errorf("body got:%s want:!!!", envelope.Body)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,26 +14,16 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
-	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/xrpc"
-	"github.com/go-zeromq/zmq4"
 	"github.com/kylemcc/twitter-text-go/extract"
 	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
 	"golang.org/x/exp/slog"
 )
 
-const (
-	ZmqSubscribeType = "VXSE45"
-)
-
-type Event struct {
-	XmlId       string
-	Serial      int
-	Message     string
-	FeedRef     *comatproto.RepoStrongRef
-	RootFeedRef *comatproto.RepoStrongRef
-	ExpiresAt   time.Time
-}
+// Limit は投稿できる文字数。Blueskyは書記素クラスタで数える
+var Limit = eew.Limit{Max: 300, Count: eew.CountGraphemes}
 
 // URLを抽出してEntitiesを生成
 func generateLinkEntities(txt string) []*appbsky.FeedPost_Entity {
@@ -135,145 +126,226 @@ func refreshSession(ctx context.Context, host, authFile string) error {
 	return err
 }
 
-func Run(ctx context.Context, zmqEndpoint, pdsUrl, authFile string) error {
-	sub := zmq4.NewSub(ctx, zmq4.WithAutomaticReconnect(true))
-	defer sub.Close()
-	if err := sub.Dial(zmqEndpoint); err != nil {
-		slog.Error("Failed to dial zmq4 pubsub", err, slog.Any("zmq", zmqEndpoint))
-		return err
+// URIの末尾がrkeyになる
+// at://did:plc:xxx/app.bsky.feed.post/rkey
+func deleteRecord(ctx context.Context, xrpcc *xrpc.Client, ref sink.Ref) error {
+	i := strings.LastIndex(ref.Id, "/")
+	if i < 0 {
+		return fmt.Errorf("invalid uri: %s", ref.Id)
 	}
-	if err := sub.SetOption(zmq4.OptionSubscribe, ZmqSubscribeType); err != nil {
-		slog.Error("Failed to set option for subscribe", err)
-		return err
+	return comatproto.RepoDeleteRecord(ctx, xrpcc, &comatproto.RepoDeleteRecord_Input{
+		Collection: "app.bsky.feed.post",
+		Repo:       xrpcc.Auth.Did,
+		Rkey:       ref.Id[i+1:],
+	})
+}
+
+// sink.RefのIdにUri、CidにCidを入れる
+func strongRef(ref sink.Ref) *comatproto.RepoStrongRef {
+	return &comatproto.RepoStrongRef{
+		Uri: ref.Id,
+		Cid: ref.Cid,
 	}
+}
+
+type Publisher struct {
+	pdsUrl   string
+	authFile string
 
+	mu    sync.Mutex
+	xrpcc *xrpc.Client
+}
+
+func NewPublisher(ctx context.Context, pdsUrl, authFile string) (*Publisher, error) {
 	xrpcc, err := createSession(ctx, pdsUrl, authFile)
 	if err != nil {
 		slog.Error("Failed to create session. try refresh", err)
 		err := refreshSession(ctx, pdsUrl, authFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		xrpcc, err = createSession(ctx, pdsUrl, authFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		slog.Info("Succeed to refresh session")
 	}
 	slog.Info("Succeed to create session")
+	return &Publisher{
+		pdsUrl:   pdsUrl,
+		authFile: authFile,
+		xrpcc:    xrpcc,
+	}, nil
+}
 
-	var eventMap sync.Map
-	go func() {
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for now := range ticker.C {
-			eventMap.Range(func(k, v any) bool {
-				if v.(Event).ExpiresAt.After(now) {
-					eventMap.Delete(k)
-				}
-				return true
-			})
-		}
-	}()
-
-	ch := make(chan Event, 10)
-	// pubsubを受けてchannelに流す
-	go func(ch chan<- Event) {
-		defer close(ch)
-		for {
-			msg, err := sub.Recv()
-			if err != nil {
-				slog.Error("Failed to receive from pubsub", err)
-				break
-			}
-			slog.Info("Succeed to receive from pubsub", slog.Any("msg", msg))
+func (p *Publisher) client() *xrpc.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.xrpcc
+}
 
-			content, err := eew.NewContent(bytes.NewReader(msg.Frames[1]))
-			if err != nil {
-				slog.Error("Failed to parse xml", err)
-				continue
-			}
-			ev := Event{
-				XmlId:   content.EventId,
-				Serial:  int(content.Serial),
-				Message: content.String(),
-			}
-			ch <- ev
-		}
-	}(ch)
+func (p *Publisher) refresh(ctx context.Context) error {
+	err := refreshSession(ctx, p.pdsUrl, p.authFile)
+	if err != nil {
+		return err
+	}
+	xrpcc, err := createSession(ctx, p.pdsUrl, p.authFile)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.xrpcc = xrpcc
+	p.mu.Unlock()
+	slog.Info("Succeed to refresh session")
+	return nil
+}
 
-	// 現時点でaccess tokenの有効期限は120分。30分ごとにrefreshしておく
-	// https://github.com/bluesky-social/atproto/blob/8dfcb4f9963823aeeaeeae143e05537dbcfd3b46/packages/pds/src/auth.ts#L40-L67
+// 現時点でaccess tokenの有効期限は120分。30分ごとにrefreshしておく
+// https://github.com/bluesky-social/atproto/blob/8dfcb4f9963823aeeaeeae143e05537dbcfd3b46/packages/pds/src/auth.ts#L40-L67
+func (p *Publisher) keepSession(ctx context.Context) error {
 	ticker := time.NewTicker(30 * time.Minute)
 	defer ticker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
 		case <-ticker.C:
-			err := refreshSession(ctx, pdsUrl, authFile)
-			if err != nil {
+			if err := p.refresh(ctx); err != nil {
 				return err
 			}
-			xrpcc, err = createSession(ctx, pdsUrl, authFile)
-			if err != nil {
-				return err
-			}
-			slog.Info("Succeed to refresh session")
-		case ev, ok := <-ch:
-			if !ok {
-				slog.Warn("closed channel")
-				return fmt.Errorf("closed channel")
-			}
-			var reply *appbsky.FeedPost_ReplyRef
-			if v, ok := eventMap.Load(ev.XmlId); ok {
-				prev := v.(Event)
-				// 過去報もしくは同じものが届いた場合はスキップ
-				if ev.Serial <= prev.Serial {
-					slog.Info("Skip old serial", slog.Any("now", ev), slog.Any("prev", prev))
-					continue
-				}
-				if prev.RootFeedRef == nil {
-					// 空になっているのはおかしいので警告
-					slog.Warn("Failed to get Root", slog.Any("event", ev))
-				} else {
-					reply = &appbsky.FeedPost_ReplyRef{
-						Parent: prev.FeedRef,
-						Root:   prev.RootFeedRef,
-					}
-					// rootイベントは引き継ぐ
-					ev.RootFeedRef = prev.RootFeedRef
-				}
-			}
+		}
+	}
+}
 
-			entities := generateLinkEntities(ev.Message)
-			record := comatproto.RepoCreateRecord_Input{
-				Collection: "app.bsky.feed.post",
-				Repo:       xrpcc.Auth.Did,
-				Record: &lexutil.LexiconTypeDecoder{
-					Val: &appbsky.FeedPost{
-						Text:      ev.Message,
-						CreatedAt: time.Now().Format("2006-01-02T15:04:05.000Z"),
-						Reply:     reply,
-						Entities:  entities,
-					},
-				},
-			}
+// uploadImage は地図画像をblobとしてアップロードして埋め込みにする。失敗したら画像なしで投稿する
+func uploadImage(ctx context.Context, xrpcc *xrpc.Client, img *sink.Image) *appbsky.FeedPost_Embed {
+	if img == nil {
+		return nil
+	}
+	// RepoUploadBlobはContent-Typeを*/*で送るので画像の形式を指定する
+	var out comatproto.RepoUploadBlob_Output
+	err := xrpcc.Do(ctx, xrpc.Procedure, img.MimeType, "com.atproto.repo.uploadBlob", nil, bytes.NewReader(img.Data), &out)
+	if err != nil {
+		slog.Error("Failed to upload blob", err)
+		return nil
+	}
+	slog.Info("Succeed to upload blob", slog.Any("blob", out.Blob))
+	return &appbsky.FeedPost_Embed{
+		EmbedImages: &appbsky.EmbedImages{
+			Images: []*appbsky.EmbedImages_Image{
+				{Alt: img.Alt, Image: out.Blob},
+			},
+		},
+	}
+}
 
-			// TODO 投稿しようとして失敗したらsession再生成
-			resp, err := comatproto.RepoCreateRecord(ctx, xrpcc, &record)
-			if err != nil {
-				return fmt.Errorf("failed to create record: %w", err)
-			}
-			slog.Info("Succeed to post record", slog.Any("record", record))
-			// CidとUriはreplyに使われるので記録しておく
-			ev.FeedRef = &comatproto.RepoStrongRef{
-				Cid: resp.Cid,
-				Uri: resp.Uri,
-			}
-			// rootが設定されていなければ自分がrootになる
-			if ev.RootFeedRef == nil {
-				ev.RootFeedRef = ev.FeedRef
-			}
-			eventMap.Store(ev.XmlId, ev)
+// feedPost は使っているindigoのFeedPostにないlangsを加えた投稿
+type feedPost struct {
+	*appbsky.FeedPost
+	Langs []string `json:"langs,omitempty"`
+}
+
+// createRecordInput はrecordにfeedPostを入れるためのcom.atproto.repo.createRecordの入力
+type createRecordInput struct {
+	Collection string    `json:"collection"`
+	Repo       string    `json:"repo"`
+	Record     *feedPost `json:"record"`
+}
+
+func (p *Publisher) createRecord(ctx context.Context, m sink.Message, reply *appbsky.FeedPost_ReplyRef) (sink.Ref, error) {
+	xrpcc := p.client()
+	text := m.Text
+	entities := generateLinkEntities(text)
+	record := createRecordInput{
+		Collection: "app.bsky.feed.post",
+		Repo:       xrpcc.Auth.Did,
+		Record: &feedPost{
+			FeedPost: &appbsky.FeedPost{
+				LexiconTypeID: "app.bsky.feed.post",
+				Text:          text,
+				CreatedAt:     time.Now().Format("2006-01-02T15:04:05.000Z"),
+				Reply:         reply,
+				Entities:      entities,
+				Embed:         uploadImage(ctx, xrpcc, m.Image),
+			},
+		},
+	}
+	if m.Language != "" {
+		record.Record.Langs = []string{string(m.Language)}
+	}
+
+	// TODO 投稿しようとして失敗したらsession再生成
+	var resp comatproto.RepoCreateRecord_Output
+	if err := xrpcc.Do(ctx, xrpc.Procedure, "application/json", "com.atproto.repo.createRecord", nil, &record, &resp); err != nil {
+		return sink.Ref{}, fmt.Errorf("failed to create record: %w", err)
+	}
+	slog.Info("Succeed to post record", slog.Any("record", record))
+	// CidとUriはreplyに使われるので記録しておく
+	return sink.Ref{
+		Id:  resp.Uri,
+		Cid: resp.Cid,
+	}, nil
+}
+
+func (p *Publisher) Post(ctx context.Context, m sink.Message) (sink.Ref, error) {
+	return p.createRecord(ctx, m, nil)
+}
+
+func (p *Publisher) Reply(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	return p.createRecord(ctx, m, &appbsky.FeedPost_ReplyRef{
+		Parent: strongRef(t.Last),
+		Root:   strongRef(t.Root),
+	})
+}
+
+// Retract はスレッドに取消を投稿し、最初の投稿と返信先を残してこれまでの投稿を削除する
+func (p *Publisher) Retract(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	ref, err := p.Reply(ctx, m, t)
+	if err != nil {
+		return ref, err
+	}
+	xrpcc := p.client()
+	for _, post := range t.Deletable() {
+		if err := deleteRecord(ctx, xrpcc, post); err != nil {
+			slog.Error("Failed to delete record", err, slog.Any("ref", post))
+			continue
+		}
+		slog.Info("Succeed to delete record", slog.Any("ref", post))
+	}
+	return ref, nil
+}
+
+func Run(ctx context.Context, src sink.Source, pdsUrl, authFile string, training sink.TrainingMode, policy sink.Policy, renderers []*eew.Renderer, attachMap bool, store state.Store) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	p, err := NewPublisher(ctx, pdsUrl, authFile)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := p.keepSession(ctx); err != nil {
+			slog.Error("Failed to refresh session", err)
+			// Runnerを終了させる
+			cancel(err)
 		}
+	}()
+
+	r := sink.Runner{
+		Name:      "bluesky",
+		Publisher: p,
+		Store:     store,
+		Training:  training,
+		Policy:    policy,
+		Renderers: renderers,
+		Map:       attachMap,
+	}
+	if err := r.Run(ctx, src); err != nil {
+		return err
+	}
+	// 親のctxが終了した場合はcontext.Canceledになる
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,90 @@
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+)
+
+func TestUploadImage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.uploadBlob" {
+			http.NotFound(w, r)
+			return
+		}
+		// 画像の形式で送る
+		if got := r.Header.Get("Content-Type"); got != "image/png" {
+			t.Errorf("content type got:%q want:image/png", got)
+		}
+		if b, _ := io.ReadAll(r.Body); string(b) != "png" {
+			t.Errorf("body got:%q", b)
+		}
+		fmt.Fprint(w, `{"blob":{"$type":"blob","ref":{"$link":"bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},"mimeType":"image/png","size":3}}`)
+	}))
+	defer srv.Close()
+
+	xrpcc := &xrpc.Client{Client: srv.Client(), Host: srv.URL, Auth: &xrpc.AuthInfo{Did: "did:plc:test"}}
+	img := &sink.Image{Data: []byte("png"), MimeType: "image/png", Alt: "震央の地図。"}
+	embed := uploadImage(context.Background(), xrpcc, img)
+	if embed == nil || embed.EmbedImages == nil || len(embed.EmbedImages.Images) != 1 {
+		t.Fatalf("got:%+v", embed)
+	}
+	if got := embed.EmbedImages.Images[0]; got.Alt != img.Alt || got.Image.MimeType != "image/png" {
+		t.Errorf("got:%+v", got)
+	}
+
+	// 失敗したら画像なし
+	xrpcc.Host = srv.URL + "/none"
+	if embed := uploadImage(context.Background(), xrpcc, img); embed != nil {
+		t.Errorf("unexpected embed: %+v", embed)
+	}
+}
+
+func TestCreateRecord(t *testing.T) {
+	var got createRecordInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.createRecord" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid record: %v", err)
+		}
+		fmt.Fprint(w, `{"uri":"at://did:plc:test/app.bsky.feed.post/abc","cid":"cid"}`)
+	}))
+	defer srv.Close()
+
+	p := &Publisher{xrpcc: &xrpc.Client{Client: srv.Client(), Host: srv.URL, Auth: &xrpc.AuthInfo{Did: "did:plc:test"}}}
+	tests := []struct {
+		Language eew.Language
+		Want     []string
+	}{
+		{"en", []string{"en"}},
+		// 言語がなければlangsを付けない
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got = createRecordInput{}
+		ref, err := p.Post(context.Background(), sink.Message{Text: "text", Language: tt.Language})
+		if err != nil {
+			t.Fatalf("failed to post: %v", err)
+		}
+		if ref.Id != "at://did:plc:test/app.bsky.feed.post/abc" || ref.Cid != "cid" {
+			t.Errorf("ref got:%+v", ref)
+		}
+		if got.Collection != "app.bsky.feed.post" || got.Repo != "did:plc:test" || got.Record.LexiconTypeID != "app.bsky.feed.post" || got.Record.Text != "text" {
+			t.Errorf("record got:%+v", got)
+		}
+		if fmt.Sprint(got.Record.Langs) != fmt.Sprint(tt.Want) {
+			t.Errorf("%q: langs got:%v want:%v", tt.Language, got.Record.Langs, tt.Want)
+		}
+	}
+}
@@ -1,38 +1,7 @@
 package main
 
-import (
-	"context"
-	"flag"
-	"os"
-
-	"github.com/matsuu/namazu/eew"
-	"github.com/matsuu/namazu/nostr"
-	"golang.org/x/exp/slog"
-)
+import "github.com/matsuu/namazu/internal/cli"
 
 func main() {
-
-	var nsec string
-	flag.StringVar(&nsec, "nsec", "", "nsec for nostr")
-
-	var zmqEndpoint string
-	flag.StringVar(&zmqEndpoint, "zmq", eew.DefaultZmqEndpoint, "zeromq endpoint")
-
-	flag.Parse()
-
-	if nsec == "" {
-		nsec = os.Getenv("NOSTR_SECRET_KEY")
-	}
-
-	if zmqEndpoint == eew.DefaultZmqEndpoint {
-		if v := os.Getenv("ZMQ_ENDPOINT"); v != "" {
-			zmqEndpoint = os.Getenv("ZMQ_ENDPOINT")
-		}
-	}
-
-	ctx := context.Background()
-	if err := nostr.Run(ctx, nsec, zmqEndpoint); err != nil {
-		slog.Error("Failed to send to nostr", err)
-		os.Exit(1)
-	}
+	cli.Main(cli.Nostr)
 }
@@ -0,0 +1,436 @@
+// Package config はnamazuと各namazu2*コマンド共通の設定ファイルを扱う
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// Secret は値を直接書くか、ファイルまたは環境変数から読み込む
+//
+//	access_token: xxxx
+//	access_token: {file: /run/secrets/mstdn_access_token}
+//	access_token: {env: MSTDN_ACCESS_TOKEN}
+type Secret string
+
+func (s *Secret) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*s = Secret(n.Value)
+		return nil
+	}
+	var ref struct {
+		File string `yaml:"file"`
+		Env  string `yaml:"env"`
+	}
+	if err := n.Decode(&ref); err != nil {
+		return err
+	}
+	switch {
+	case ref.File != "":
+		b, err := os.ReadFile(ref.File)
+		if err != nil {
+			return fmt.Errorf("line %d: failed to read secret: %w", n.Line, err)
+		}
+		*s = Secret(strings.TrimSpace(string(b)))
+	case ref.Env != "":
+		*s = Secret(os.Getenv(ref.Env))
+	default:
+		return fmt.Errorf("line %d: secret requires file or env", n.Line)
+	}
+	return nil
+}
+
+// ログにそのまま出さない
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "***"
+}
+
+type Log struct {
+	// debug, info, warn, error
+	Level string `yaml:"level"`
+	// text, json
+	Format string `yaml:"format"`
+}
+
+type DMData struct {
+	ApiKey Secret `yaml:"api_key"`
+	// 省略時はhttps://api.dmdata.jp。mock-dmdataで試すときに変更する
+	ApiBase string `yaml:"api_base"`
+	// xml, json
+	Format string `yaml:"format"`
+	// 受け取る区分。eew.forecast、eew.warning、telegram.earthquake
+	Classifications []string `yaml:"classifications"`
+}
+
+type ZeroMQ struct {
+	Endpoint string `yaml:"endpoint"`
+}
+
+type State struct {
+	// 空ならメモリ上にのみ保持する。複数のsinkのプロセスで共有できる
+	File string `yaml:"file"`
+}
+
+type Archive struct {
+	// 受信した電文を保存するディレクトリ。空なら保存しない
+	Dir string `yaml:"dir"`
+}
+
+type Policy struct {
+	Reports        string   `yaml:"reports"`
+	MinIntensity   string   `yaml:"min_intensity"`
+	MinLgIntensity string   `yaml:"min_lg_intensity"`
+	MinMagnitude   float64  `yaml:"min_magnitude"`
+	Areas          []string `yaml:"areas"`
+}
+
+// Limit は投稿文の長さの上限。省略した項目はSNSごとの既定値を使う
+type Limit struct {
+	// 文字数。0ならSNSの既定値
+	Max int `yaml:"max"`
+	// runes、graphemes、bytes
+	Count string `yaml:"count"`
+}
+
+// Sink は各SNS共通の設定
+type Sink struct {
+	Training string `yaml:"training"`
+	Policy   Policy `yaml:"policy"`
+	// 既定のテンプレートを上書きするtext/templateのファイル。空なら既定のまま
+	Template string `yaml:"template"`
+	// 投稿文の言語。ja、en、zh、ko。空ならjaのみ
+	Languages []string `yaml:"languages"`
+	// trueなら全言語の投稿文を1つにまとめる。falseなら言語ごとにスレッドを分ける
+	CombineLanguages bool `yaml:"combine_languages"`
+	// 上限に収まらない投稿文は補足から順に省き、最後は切り詰める
+	Limit Limit `yaml:"limit"`
+	// trueなら震度分布と震央の地図画像を添付する
+	Map bool `yaml:"map"`
+}
+
+type Mastodon struct {
+	Sink         `yaml:",inline"`
+	Server       string `yaml:"server"`
+	ClientId     Secret `yaml:"client_id"`
+	ClientSecret Secret `yaml:"client_secret"`
+	AccessToken  Secret `yaml:"access_token"`
+}
+
+type Bluesky struct {
+	Sink     `yaml:",inline"`
+	PdsHost  string `yaml:"pds_host"`
+	AuthFile string `yaml:"auth_file"`
+}
+
+type Nostr struct {
+	Sink `yaml:",inline"`
+	Nsec Secret `yaml:"nsec"`
+	// 地図画像をアップロードするNIP-96のサーバー。空なら添付しない
+	ImageServer string `yaml:"image_server"`
+}
+
+type Mixi2 struct {
+	Sink      `yaml:",inline"`
+	AuthKey   Secret `yaml:"auth_key"`
+	AuthToken Secret `yaml:"auth_token"`
+	UserAgent string `yaml:"user_agent"`
+}
+
+// Sinks は設定されたSNSのみ投稿する
+type Sinks struct {
+	Mastodon *Mastodon `yaml:"mastodon"`
+	Bluesky  *Bluesky  `yaml:"bluesky"`
+	Nostr    *Nostr    `yaml:"nostr"`
+	Mixi2    *Mixi2    `yaml:"mixi2"`
+}
+
+type Config struct {
+	Log     Log     `yaml:"log"`
+	DMData  DMData  `yaml:"dmdata"`
+	ZeroMQ  ZeroMQ  `yaml:"zmq"`
+	State   State   `yaml:"state"`
+	Archive Archive `yaml:"archive"`
+	Sinks   Sinks   `yaml:"sinks"`
+}
+
+var ErrNoApiKey = errors.New("dmdata.api_key is required")
+
+// Default は設定ファイルで省略された値
+func Default() *Config {
+	return &Config{
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		DMData: DMData{
+			Format:          "xml",
+			Classifications: []string{eew.ClassificationForecast},
+		},
+		ZeroMQ: ZeroMQ{
+			Endpoint: eew.DefaultZmqEndpoint,
+		},
+	}
+}
+
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func Parse(r io.Reader) (*Config, error) {
+	c := Default()
+	dec := yaml.NewDecoder(r)
+	// 設定項目の書き間違いに気づけるようにする
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate は設定の誤りをまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := c.Log.Handler(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.DMData.ApiBase != "" {
+		if u, err := url.Parse(c.DMData.ApiBase); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("dmdata.api_base must be http or https url: %s", c.DMData.ApiBase))
+		}
+	}
+	switch c.DMData.Format {
+	case "xml", "json":
+	default:
+		errs = append(errs, fmt.Errorf("dmdata.format must be xml or json: %s", c.DMData.Format))
+	}
+	if len(c.DMData.Classifications) == 0 {
+		errs = append(errs, fmt.Errorf("dmdata.classifications is required"))
+	}
+	for _, v := range c.DMData.Classifications {
+		if !eew.IsClassification(v) {
+			errs = append(errs, fmt.Errorf("dmdata.classifications: unknown classification: %s", v))
+		}
+		// JSON形式は緊急地震速報のみ読める
+		if v == eew.ClassificationEarthquake && c.DMData.Format == "json" {
+			errs = append(errs, fmt.Errorf("dmdata.format: json does not support %s", v))
+		}
+	}
+	if c.ZeroMQ.Endpoint == "" {
+		errs = append(errs, fmt.Errorf("zmq.endpoint is required"))
+	}
+	if m := c.Sinks.Mastodon; m != nil {
+		if m.Server == "" {
+			errs = append(errs, fmt.Errorf("sinks.mastodon.server is required"))
+		}
+		if m.AccessToken == "" {
+			errs = append(errs, fmt.Errorf("sinks.mastodon.access_token is required"))
+		}
+		errs = append(errs, m.Sink.validate("mastodon")...)
+	}
+	if b := c.Sinks.Bluesky; b != nil {
+		if b.PdsHost == "" {
+			errs = append(errs, fmt.Errorf("sinks.bluesky.pds_host is required"))
+		}
+		if b.AuthFile == "" {
+			errs = append(errs, fmt.Errorf("sinks.bluesky.auth_file is required"))
+		}
+		errs = append(errs, b.Sink.validate("bluesky")...)
+	}
+	if n := c.Sinks.Nostr; n != nil {
+		if n.Map && n.ImageServer == "" {
+			errs = append(errs, fmt.Errorf("sinks.nostr.image_server is required to attach a map"))
+		}
+		errs = append(errs, n.Sink.validate("nostr")...)
+	}
+	if m := c.Sinks.Mixi2; m != nil {
+		if m.AuthKey == "" {
+			errs = append(errs, fmt.Errorf("sinks.mixi2.auth_key is required"))
+		}
+		if m.AuthToken == "" {
+			errs = append(errs, fmt.Errorf("sinks.mixi2.auth_token is required"))
+		}
+		if m.Map {
+			errs = append(errs, fmt.Errorf("sinks.mixi2.map: attaching images is not supported"))
+		}
+		errs = append(errs, m.Sink.validate("mixi2")...)
+	}
+	return errors.Join(errs...)
+}
+
+func (s Sink) validate(name string) []error {
+	var errs []error
+	if _, err := s.TrainingMode(); err != nil {
+		errs = append(errs, fmt.Errorf("sinks.%s.training: %w", name, err))
+	}
+	if _, err := s.SinkPolicy(""); err != nil {
+		errs = append(errs, fmt.Errorf("sinks.%s.policy: %w", name, err))
+	}
+	if _, err := s.languages(); err != nil {
+		errs = append(errs, fmt.Errorf("sinks.%s.languages: %w", name, err))
+	} else if _, err := s.Renderers(eew.Limit{}); err != nil {
+		errs = append(errs, fmt.Errorf("sinks.%s.template: %w", name, err))
+	}
+	if _, err := s.RenderLimit(eew.Limit{}); err != nil {
+		errs = append(errs, fmt.Errorf("sinks.%s.limit: %w", name, err))
+	}
+	return errs
+}
+
+func (s Sink) TrainingMode() (sink.TrainingMode, error) {
+	return sink.ParseTrainingMode(s.Training)
+}
+
+func (s Sink) languages() ([]eew.Language, error) {
+	var langs []eew.Language
+	for _, v := range s.Languages {
+		l, err := eew.ParseLanguage(v)
+		if err != nil {
+			return nil, err
+		}
+		langs = append(langs, l)
+	}
+	return langs, nil
+}
+
+// RenderLimit はeew.Limitに変換する。省略された項目はdefaultLimitを使う
+func (s Sink) RenderLimit(defaultLimit eew.Limit) (eew.Limit, error) {
+	l := defaultLimit
+	if s.Limit.Max < 0 {
+		return l, fmt.Errorf("max must not be negative: %d", s.Limit.Max)
+	}
+	if s.Limit.Max > 0 {
+		l.Max = s.Limit.Max
+	}
+	if s.Limit.Count != "" {
+		c, err := eew.ParseCount(s.Limit.Count)
+		if err != nil {
+			return l, err
+		}
+		l.Count = c
+	}
+	return l, nil
+}
+
+// Renderers は言語ごとにtemplateで上書きしたeew.Rendererを作る。
+// combine_languagesなら全言語をまとめた1つのみ。limitが省略されていればdefaultLimitに収める
+func (s Sink) Renderers(defaultLimit eew.Limit) ([]*eew.Renderer, error) {
+	langs, err := s.languages()
+	if err != nil {
+		return nil, err
+	}
+	limit, err := s.RenderLimit(defaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	if s.CombineLanguages || len(langs) <= 1 {
+		r, err := eew.NewRenderer(s.Template, langs...)
+		if err != nil {
+			return nil, err
+		}
+		return []*eew.Renderer{r.WithLimit(limit)}, nil
+	}
+	var rs []*eew.Renderer
+	for _, l := range langs {
+		r, err := eew.NewRenderer(s.Template, l)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r.WithLimit(limit))
+	}
+	return rs, nil
+}
+
+// SinkPolicy はsink.Policyに変換する。reportsが省略されていればdefaultReportsを使う
+func (s Sink) SinkPolicy(defaultReports sink.Reports) (sink.Policy, error) {
+	p := sink.Policy{
+		Reports:      defaultReports,
+		MinMagnitude: s.Policy.MinMagnitude,
+		Areas:        s.Policy.Areas,
+	}
+	var err error
+	if s.Policy.Reports != "" {
+		if p.Reports, err = sink.ParseReports(s.Policy.Reports); err != nil {
+			return p, err
+		}
+	}
+	if p.MinIntensity, err = sink.ParseIntensity(s.Policy.MinIntensity); err != nil {
+		return p, err
+	}
+	if p.MinLgIntensity, err = sink.ParseLgIntensity(s.Policy.MinLgIntensity); err != nil {
+		return p, err
+	}
+	if p.MinMagnitude < 0 {
+		return p, fmt.Errorf("min_magnitude must not be negative: %v", p.MinMagnitude)
+	}
+	return p, nil
+}
+
+// Handler はログの設定からslog.Handlerを作る
+func (l Log) Handler() (slog.Handler, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return nil, fmt.Errorf("log.level: %w", err)
+	}
+	opts := slog.HandlerOptions{Level: level}
+	switch l.Format {
+	case "text", "":
+		return opts.NewTextHandler(os.Stderr), nil
+	case "json":
+		return opts.NewJSONHandler(os.Stderr), nil
+	}
+	return nil, fmt.Errorf("log.format: unknown format: %s", l.Format)
+}
+
+// SetupLog はslogのデフォルトを設定に合わせる
+func (l Log) SetupLog() error {
+	h, err := l.Handler()
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// RegisterFlags はコマンドラインからSinkを設定するためのフラグを登録する
+// 環境変数TRAINING_MODEも参照する
+func (s *Sink) RegisterFlags(fs *flag.FlagSet, defaultReports sink.Reports) {
+	fs.StringVar(&s.Training, "training", os.Getenv("TRAINING_MODE"), "how to handle training/test telegrams: drop, only or prefix")
+	fs.StringVar(&s.Policy.Reports, "reports", string(defaultReports), "which reports to post in a thread: all, first-last or intensity-change")
+	fs.StringVar(&s.Policy.MinIntensity, "min-intensity", "", "minimum forecast intensity to start a thread (e.g. 4, 5-)")
+	fs.StringVar(&s.Policy.MinLgIntensity, "min-lg-intensity", "", "minimum forecast long-period ground motion class to start a thread (1-4)")
+	fs.StringVar(&s.Template, "template", "", "path to text/template file overriding the default message templates")
+	fs.Func("languages", "comma separated languages of messages: ja, en, zh, ko", func(v string) error {
+		s.Languages = strings.Split(v, ",")
+		return nil
+	})
+	fs.BoolVar(&s.CombineLanguages, "combine-languages", false, "post all languages in one message instead of a thread per language")
+	fs.IntVar(&s.Limit.Max, "limit-max", 0, "maximum length of a message (0 uses the default of the sink)")
+	fs.StringVar(&s.Limit.Count, "limit-count", "", "how to count the length of a message: runes, graphemes or bytes")
+	fs.BoolVar(&s.Map, "map", false, "attach a map image of seismic intensities and the epicenter")
+	fs.Float64Var(&s.Policy.MinMagnitude, "min-magnitude", 0, "minimum magnitude to start a thread")
+	fs.Func("areas", "comma separated prefecture/area codes to start a thread", func(v string) error {
+		s.Policy.Areas = strings.Split(v, ",")
+		return nil
+	})
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("NAMAZU_TEST_DMDATA_API_KEY", "apikey")
+	t.Setenv("NAMAZU_TEST_NOSTR_SECRET_KEY", "nsec")
+
+	c, err := Load("testdata/namazu.yaml")
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if got, want := c.DMData.ApiKey, Secret("apikey"); got != want {
+		t.Errorf("api_key got:%s want:%s", got, want)
+	}
+	if got, want := c.DMData.Classifications, []string{"eew.warning"}; !slices.Equal(got, want) {
+		t.Errorf("classifications got:%v want:%v", got, want)
+	}
+	m := c.Sinks.Mastodon
+	if m == nil {
+		t.Fatalf("mastodon is not configured")
+	}
+	if got, want := m.AccessToken, Secret("s3cr3t"); got != want {
+		t.Errorf("access_token got:%s want:%s", got, want)
+	}
+	if got, want := m.ClientId, Secret("client-id"); got != want {
+		t.Errorf("client_id got:%s want:%s", got, want)
+	}
+	if c.Sinks.Mixi2 != nil {
+		t.Errorf("mixi2 is configured: %+v", c.Sinks.Mixi2)
+	}
+
+	n := c.Sinks.Nostr
+	if got, _ := n.TrainingMode(); got != sink.TrainingOnly {
+		t.Errorf("training got:%s want:%s", got, sink.TrainingOnly)
+	}
+	p, err := n.SinkPolicy(sink.ReportsAll)
+	if err != nil {
+		t.Fatalf("failed to get policy: %v", err)
+	}
+	if p.Reports != sink.ReportsFirstLast || p.MinIntensity != "5-" || p.MinLgIntensity != "3" || p.MinMagnitude != 5.0 || len(p.Areas) != 2 {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if !n.Map || n.ImageServer != "https://nostr.build" || c.Sinks.Bluesky.Map {
+		t.Errorf("unexpected map: %v %s %v", n.Map, n.ImageServer, c.Sinks.Bluesky.Map)
+	}
+	// 言語ごとにスレッドを分ける
+	if rs, err := n.Renderers(eew.Limit{}); err != nil || len(rs) != 2 || rs[1].Language() != eew.LanguageEnglish {
+		t.Errorf("unexpected renderers: %v %v", rs, err)
+	}
+	// 全言語を1つにまとめる
+	if rs, err := c.Sinks.Bluesky.Renderers(eew.Limit{}); err != nil || len(rs) != 1 || rs[0].Language() != eew.LanguageJapanese {
+		t.Errorf("unexpected combined renderers: %v %v", rs, err)
+	}
+	// 数え方は既定値のまま上限だけ変える
+	defaultLimit := eew.Limit{Max: 300, Count: eew.CountGraphemes}
+	if got, err := c.Sinks.Bluesky.RenderLimit(defaultLimit); err != nil || got != (eew.Limit{Max: 280, Count: eew.CountGraphemes}) {
+		t.Errorf("unexpected limit: %+v %v", got, err)
+	}
+	if got, _ := n.RenderLimit(defaultLimit); got != defaultLimit {
+		t.Errorf("default limit got:%+v want:%+v", got, defaultLimit)
+	}
+	p, _ = c.Sinks.Bluesky.SinkPolicy(sink.ReportsAll)
+	if p.Reports != sink.ReportsAll {
+		t.Errorf("default reports got:%s want:%s", p.Reports, sink.ReportsAll)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	src := `
+log:
+  level: verbose
+dmdata:
+  api_base: ftp://127.0.0.1
+  format: yaml
+  classifications: [eew.forecast, telegram.volcano]
+sinks:
+  mastodon:
+    training: always
+    languages: [ja, fr]
+    limit:
+      count: words
+    policy:
+      min_intensity: "8"
+  nostr:
+    map: true
+  mixi2:
+    map: true
+    policy:
+      min_lg_intensity: "5-"
+    template: testdata/notfound.tmpl
+`
+	_, err := Parse(strings.NewReader(src))
+	if err == nil {
+		t.Fatalf("no error")
+	}
+	for _, want := range []string{
+		"log.level",
+		"dmdata.api_base",
+		"dmdata.format",
+		"dmdata.classifications",
+		"sinks.mastodon.server is required",
+		"sinks.mastodon.access_token is required",
+		"sinks.mastodon.training",
+		"sinks.mastodon.policy",
+		"sinks.mastodon.languages",
+		"sinks.mastodon.limit",
+		"sinks.nostr.image_server is required",
+		"sinks.mixi2.auth_key is required",
+		"sinks.mixi2.auth_token is required",
+		"sinks.mixi2.map",
+		"sinks.mixi2.policy",
+		"sinks.mixi2.template",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	src := `
+sinks:
+  mastodon:
+    acces_token: typo
+`
+	if _, err := Parse(strings.NewReader(src)); err == nil {
+		t.Errorf("no error for unknown field")
+	}
+}
+
+// JSON形式では地震情報と津波を読めない
+func TestValidateJSONFormat(t *testing.T) {
+	tests := []struct {
+		Classifications string
+		Err             bool
+	}{
+		{"[eew.forecast, eew.warning]", false},
+		{"[eew.forecast, telegram.earthquake]", true},
+	}
+	for _, tt := range tests {
+		src := `
+dmdata:
+  format: json
+  classifications: ` + tt.Classifications + `
+`
+		_, err := Parse(strings.NewReader(src))
+		if (err != nil) != tt.Err {
+			t.Errorf("%s: got:%v want error:%v", tt.Classifications, err, tt.Err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "dmdata.format") {
+			t.Errorf("%s: unexpected error: %v", tt.Classifications, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package eew
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// 震源要素が仮定の値であることを示すBody/Earthquake/Condition
+const ConditionAssumedHypocenter = "仮定震源要素"
+
+// HypocenterRank は震央・深さの確からしさ（Epicenter、Depthのrank）
+type HypocenterRank int
+
+const (
+	HypocenterUnknown HypocenterRank = iota
+	// P波／S波レベル超え、IPF法（1点）、または仮定震源要素
+	HypocenterSingle
+	// IPF法（2点）
+	HypocenterIPF2
+	// IPF法（3点／4点）
+	HypocenterIPF3
+	// IPF法（5点以上）
+	HypocenterIPF5
+	// 防災科研システム（4点以下、または精度情報なし）
+	HypocenterNIED4
+	// 防災科研システム（5点以上）
+	HypocenterNIED5
+	// EPOS（海域［観測網外］）
+	HypocenterEPOSSea
+	// EPOS（内陸［観測網内］）
+	HypocenterEPOSLand
+	// 震源とマグニチュードに基づく震度予測手法での精度が最終報相当。rank2のみ
+	HypocenterFinal HypocenterRank = 9
+)
+
+func (r HypocenterRank) String() string {
+	switch r {
+	case HypocenterSingle:
+		return "P波／S波レベル超え、IPF法（1点）、または仮定震源要素"
+	case HypocenterIPF2:
+		return "IPF法（2点）"
+	case HypocenterIPF3:
+		return "IPF法（3点／4点）"
+	case HypocenterIPF5:
+		return "IPF法（5点以上）"
+	case HypocenterNIED4:
+		return "防災科研システム（4点以下、または精度情報なし）"
+	case HypocenterNIED5:
+		return "防災科研システム（5点以上）"
+	case HypocenterEPOSSea:
+		return "EPOS（海域）"
+	case HypocenterEPOSLand:
+		return "EPOS（内陸）"
+	case HypocenterFinal:
+		return "最終報相当"
+	}
+	return "不明"
+}
+
+// MagnitudeRank はマグニチュードの確からしさ（MagnitudeCalculationのrank）
+type MagnitudeRank int
+
+const (
+	MagnitudeUnknown MagnitudeRank = 0
+	// 防災科研システム
+	MagnitudeNIED MagnitudeRank = 2
+	// 全点P相
+	MagnitudeP MagnitudeRank = 3
+	// P相／全相混在
+	MagnitudeMixed MagnitudeRank = 4
+	// 全点全相
+	MagnitudeAll MagnitudeRank = 5
+	// EPOS
+	MagnitudeEPOS MagnitudeRank = 6
+	// P波／S波レベル超え、または仮定震源要素
+	MagnitudeAssumed MagnitudeRank = 8
+)
+
+func (r MagnitudeRank) String() string {
+	switch r {
+	case MagnitudeNIED:
+		return "防災科研システム"
+	case MagnitudeP:
+		return "全点P相"
+	case MagnitudeMixed:
+		return "P相／全相混在"
+	case MagnitudeAll:
+		return "全点全相"
+	case MagnitudeEPOS:
+		return "EPOS"
+	case MagnitudeAssumed:
+		return "P波／S波レベル超え、または仮定震源要素"
+	}
+	return "不明"
+}
+
+// Accuracy は震源とマグニチュードの精度。Body/Earthquake/Hypocenter/Accuracy
+type Accuracy struct {
+	// 震央の確からしさ
+	Epicenter HypocenterRank
+	// 震央の確からしさ（防災科研システムを含む緊急地震速報の処理の精度）
+	Epicenter2 HypocenterRank
+	// 深さの確からしさ
+	Depth HypocenterRank
+	// マグニチュードの確からしさ
+	Magnitude MagnitudeRank
+	// マグニチュードの計算に使った観測点の数。5は5点以上、0は不明
+	MagnitudePoints int
+}
+
+// IsLow は観測点が少なく震源やマグニチュードの精度が低い可能性があるかどうか
+func (a *Accuracy) IsLow() bool {
+	if a == nil {
+		return false
+	}
+	switch a.Epicenter {
+	case HypocenterSingle, HypocenterIPF2:
+		return true
+	}
+	return a.MagnitudePoints == 1
+}
+
+func parseRank(s string) int {
+	r, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return r
+}
+
+func parseAccuracy(root *xmlquery.Node) *Accuracy {
+	n := root.SelectElement("//Body/Earthquake/Hypocenter/Accuracy")
+	if n == nil {
+		return nil
+	}
+	var a Accuracy
+	if v := n.SelectElement("Epicenter"); v != nil {
+		a.Epicenter = HypocenterRank(parseRank(v.SelectAttr("rank")))
+		a.Epicenter2 = HypocenterRank(parseRank(v.SelectAttr("rank2")))
+	}
+	if v := n.SelectElement("Depth"); v != nil {
+		a.Depth = HypocenterRank(parseRank(v.SelectAttr("rank")))
+	}
+	if v := n.SelectElement("MagnitudeCalculation"); v != nil {
+		a.Magnitude = MagnitudeRank(parseRank(v.SelectAttr("rank")))
+	}
+	if v := n.SelectElement("NumberOfMagnitudeCalculation"); v != nil {
+		a.MagnitudePoints = parseRank(v.InnerText())
+	}
+	return &a
+}
+
+// IsAssumedHypocenter は震源が仮定震源要素かどうか。
+// PLUM法やレベル法で発表された場合は震源もマグニチュードも実際の値ではない
+func (c Content) IsAssumedHypocenter() bool {
+	return c.HypocenterCondition == ConditionAssumedHypocenter
+}
+
+// IsPLUM はPLUM法による仮定震源要素かどうか。
+// PLUM法では震度を予測した観測点の位置に深さ10km、M1.0の震源を仮定する
+func (c Content) IsPLUM() bool {
+	if !c.IsAssumedHypocenter() {
+		return false
+	}
+	m, ok := c.Magnitude.Float()
+	if !ok || m != 1.0 {
+		return false
+	}
+	if c.Depth == nil {
+		return true
+	}
+	// 深さ10kmは0と表す場合もある
+	d := math.Abs(float64(*c.Depth))
+	return d == 0 || d == 10000
+}
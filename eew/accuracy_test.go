@@ -0,0 +1,102 @@
+package eew
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAccuracy(t *testing.T) {
+	b, err := os.ReadFile("samples/77_01_01_110311_VXSE45.xml")
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	// 仮定震源要素はHypocenterの前にConditionを置く
+	assumed := strings.NewReplacer(
+		"<Hypocenter>", "<Condition>仮定震源要素</Condition><Hypocenter>",
+		`<Epicenter rank="4" rank2="4">`, `<Epicenter rank="1" rank2="1">`,
+		`<Depth rank="4">`, `<Depth rank="1">`,
+		`<MagnitudeCalculation rank="5">`, `<MagnitudeCalculation rank="8">`,
+		"<NumberOfMagnitudeCalculation>5<", "<NumberOfMagnitudeCalculation>1<",
+	)
+	plum := strings.NewReplacer(`description="Ｍ８．４">8.4<`, `description="Ｍ１．０">1.0<`)
+	single := strings.NewReplacer(
+		`<Epicenter rank="4" rank2="4">`, `<Epicenter rank="1" rank2="1">`,
+		"<NumberOfMagnitudeCalculation>5<", "<NumberOfMagnitudeCalculation>1<",
+	)
+
+	tests := []struct {
+		Name     string
+		Body     string
+		Accuracy Accuracy
+		Assumed  bool
+		PLUM     bool
+		Message  string
+	}{
+		{
+			Name:     "ipf",
+			Body:     string(b),
+			Accuracy: Accuracy{Epicenter: HypocenterIPF5, Epicenter2: HypocenterIPF5, Depth: HypocenterIPF5, Magnitude: MagnitudeAll, MagnitudePoints: 5},
+			Message:  "震源地は三陸沖（北緯38.1度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は8.4、この地震による最大震度は震度6強、長周期地震動階級4と推定されます。\n",
+		},
+		{
+			Name:     "single",
+			Body:     single.Replace(string(b)),
+			Accuracy: Accuracy{Epicenter: HypocenterSingle, Epicenter2: HypocenterSingle, Depth: HypocenterIPF5, Magnitude: MagnitudeAll, MagnitudePoints: 1},
+			Message:  "長周期地震動階級4と推定されます。\n観測点が少ないため、震源や規模の精度が低い可能性があります。\n",
+		},
+		{
+			Name:     "assumed",
+			Body:     assumed.Replace(string(b)),
+			Accuracy: Accuracy{Epicenter: HypocenterSingle, Epicenter2: HypocenterSingle, Depth: HypocenterSingle, Magnitude: MagnitudeAssumed, MagnitudePoints: 1},
+			Assumed:  true,
+			Message:  "\n震源は三陸沖付近の仮定震源要素で、地震の規模は不明です。この地震による最大震度は震度6強、長周期地震動階級4と推定されます。\n",
+		},
+		{
+			Name:     "plum",
+			Body:     plum.Replace(assumed.Replace(string(b))),
+			Accuracy: Accuracy{Epicenter: HypocenterSingle, Epicenter2: HypocenterSingle, Depth: HypocenterSingle, Magnitude: MagnitudeAssumed, MagnitudePoints: 1},
+			Assumed:  true,
+			PLUM:     true,
+			Message:  "\nPLUM法による予測のため、震源は三陸沖付近の仮定震源要素で、地震の規模は不明です。",
+		},
+	}
+	for _, tt := range tests {
+		content, err := NewContent(bytes.NewReader([]byte(tt.Body)))
+		if err != nil {
+			t.Fatalf("%s: failed to parseXml: %v", tt.Name, err)
+		}
+		if content.Accuracy == nil || *content.Accuracy != tt.Accuracy {
+			t.Errorf("%s: Accuracy got:%+v want:%+v", tt.Name, content.Accuracy, tt.Accuracy)
+		}
+		if got := content.IsAssumedHypocenter(); got != tt.Assumed {
+			t.Errorf("%s: IsAssumedHypocenter got:%v want:%v", tt.Name, got, tt.Assumed)
+		}
+		if got := content.IsPLUM(); got != tt.PLUM {
+			t.Errorf("%s: IsPLUM got:%v want:%v", tt.Name, got, tt.PLUM)
+		}
+		if got := content.String(); !strings.Contains(got, tt.Message) {
+			t.Errorf("%s: got:%s want:%s", tt.Name, got, tt.Message)
+		}
+	}
+}
+
+func TestAccuracyIsLow(t *testing.T) {
+	tests := []struct {
+		Accuracy *Accuracy
+		Want     bool
+	}{
+		{nil, false},
+		{&Accuracy{}, false},
+		{&Accuracy{Epicenter: HypocenterSingle}, true},
+		{&Accuracy{Epicenter: HypocenterIPF2, MagnitudePoints: 2}, true},
+		{&Accuracy{Epicenter: HypocenterIPF3, MagnitudePoints: 1}, true},
+		{&Accuracy{Epicenter: HypocenterEPOSSea, MagnitudePoints: 5}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.Accuracy.IsLow(); got != tt.Want {
+			t.Errorf("%+v: got:%v want:%v", tt.Accuracy, got, tt.Want)
+		}
+	}
+}
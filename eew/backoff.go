@@ -0,0 +1,34 @@
+package eew
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff はジッター付きの指数バックオフ
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max}
+}
+
+// Next は次に待つ時間を返す。待ち時間の半分をランダムにばらつかせる
+func (b *backoff) Next() time.Duration {
+	d := b.max
+	if b.attempt < 32 {
+		if v := b.min << b.attempt; v > 0 && v < b.max {
+			d = v
+			b.attempt++
+		}
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,21 @@
+package eew
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 10*time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		got := b.Next()
+		if got < w/2 || got > w {
+			t.Errorf("attempt %d: got:%s want:%s-%s", i, got, w/2, w)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got > time.Second {
+		t.Errorf("after reset: got:%s want:<=1s", got)
+	}
+}
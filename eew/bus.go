@@ -0,0 +1,125 @@
+package eew
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrClosed はBusまたはSubscriptionが閉じられた後に返る
+var ErrClosed = errors.New("closed")
+
+// Bus はZeroMQを使わずにプロセス内で電文を配る
+type Bus struct {
+	mu     sync.Mutex
+	subs   []*Subscription
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Send は種別が一致するすべての購読者へ電文を配る。詰まっている購読者には受け取られるかctxが終わるまで待つ
+func (b *Bus) Send(ctx context.Context, t Telegram) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	// 待っている間も購読の開始や終了ができるようにロックの外で送る
+	subs := slices.Clone(b.subs)
+	b.mu.Unlock()
+	for _, s := range subs {
+		if !s.match(t.Type) {
+			continue
+		}
+		select {
+		case s.ch <- &t:
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe はtopicsのいずれかで始まる種別の電文を購読する。ZeroMQのSUBと同じく前方一致
+func (b *Bus) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{
+		bus:    b,
+		topics: topics,
+		ch:     make(chan *Telegram, 100),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.done)
+		return s
+	}
+	b.subs = append(b.subs, s)
+	return s
+}
+
+func (b *Bus) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := slices.Index(b.subs, s)
+	if i < 0 {
+		return
+	}
+	b.subs = slices.Delete(b.subs, i, i+1)
+	close(s.done)
+}
+
+// Close はすべての購読を終了させる
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, s := range b.subs {
+		close(s.done)
+	}
+	b.subs = nil
+	return nil
+}
+
+type Subscription struct {
+	bus    *Bus
+	topics []string
+	ch     chan *Telegram
+	// chは送信中に閉じられないのでdoneで終了を伝える
+	done chan struct{}
+}
+
+func (s *Subscription) match(typ string) bool {
+	return slices.ContainsFunc(s.topics, func(topic string) bool {
+		return strings.HasPrefix(typ, topic)
+	})
+}
+
+// Recv は電文を受け取る。閉じられた後も届いている電文を先に返す
+func (s *Subscription) Recv() (*Telegram, error) {
+	select {
+	case t := <-s.ch:
+		return t, nil
+	default:
+	}
+	select {
+	case t := <-s.ch:
+		return t, nil
+	case <-s.done:
+		return nil, ErrClosed
+	}
+}
+
+func (s *Subscription) Close() error {
+	s.bus.remove(s)
+	return nil
+}
@@ -0,0 +1,86 @@
+package eew
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	s45 := b.Subscribe("VXSE45")
+	all := b.Subscribe("VXSE4", "VTSE")
+
+	for _, typ := range []string{"VXSE45", "VXSE43", "VXSE51"} {
+		if err := b.Send(context.Background(), Telegram{Type: typ}); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	if got, _ := s45.Recv(); got.Type != "VXSE45" {
+		t.Errorf("got:%s want:VXSE45", got.Type)
+	}
+	for _, want := range []string{"VXSE45", "VXSE43"} {
+		if got, _ := all.Recv(); got.Type != want {
+			t.Errorf("got:%s want:%s", got.Type, want)
+		}
+	}
+
+	s45.Close()
+	if _, err := s45.Recv(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got:%v want:%v", err, ErrClosed)
+	}
+	b.Close()
+	if _, err := all.Recv(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got:%v want:%v", err, ErrClosed)
+	}
+	if err := b.Send(context.Background(), Telegram{Type: "VXSE45"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("got:%v want:%v", err, ErrClosed)
+	}
+}
+
+func TestBusFull(t *testing.T) {
+	b := NewBus()
+	defer b.Close()
+	s := b.Subscribe("VXSE")
+	n := cap(s.ch)
+	for i := 0; i < n; i++ {
+		if err := b.Send(context.Background(), Telegram{Type: "VXSE45"}); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	// 詰まっていたら捨てずにctxが終わるまで待つ
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Send(ctx, Telegram{Type: "VXSE45"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got:%v want:%v", err, context.DeadlineExceeded)
+	}
+
+	// 受け取られれば送れる
+	errc := make(chan error, 1)
+	go func() {
+		errc <- b.Send(context.Background(), Telegram{Type: "VXSE43"})
+	}()
+	for i := 0; i < n; i++ {
+		if _, err := s.Recv(); err != nil {
+			t.Fatalf("failed to recv: %v", err)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("failed to send: %v", err)
+	}
+	if got, _ := s.Recv(); got.Type != "VXSE43" {
+		t.Errorf("got:%s want:VXSE43", got.Type)
+	}
+
+	// 購読を閉じれば待たない
+	for i := 0; i < n; i++ {
+		b.Send(context.Background(), Telegram{Type: "VXSE45"})
+	}
+	go s.Close()
+	if err := b.Send(context.Background(), Telegram{Type: "VXSE45"}); err != nil {
+		t.Errorf("failed to send: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package eew
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// decode はdata.Bodyを元の電文に戻す。zipに複数の電文が含まれる場合はすべて返す
+//
+// encoding、compressionはnullのことがあるので、nullなら無圧縮のutf-8として扱う
+func decode(data *WebsocketData) ([][]byte, error) {
+	encoding := deref(data.Encoding)
+	compression := deref(data.Compression)
+
+	var b []byte
+	switch encoding {
+	case "base64":
+		var err error
+		b, err = base64.StdEncoding.DecodeString(data.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+		}
+	case "utf-8", "":
+		// 圧縮されていればbase64のはず
+		if compression != "" {
+			return nil, fmt.Errorf("compressed body must be base64: encoding:%q compression:%q", encoding, compression)
+		}
+		b = []byte(data.Body)
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", encoding)
+	}
+
+	switch compression {
+	case "":
+		return [][]byte{b}, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress gzip body: %w", err)
+		}
+		defer zr.Close()
+		x, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to uncompress gzip body: %w", err)
+		}
+		return [][]byte{x}, nil
+	case "zip":
+		return unzip(b)
+	}
+	return nil, fmt.Errorf("unknown compression: %s", compression)
+}
+
+func unzip(b []byte) ([][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to uncompress zip body: %w", err)
+	}
+	var bodies [][]byte
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in zip: %w", f.Name, err)
+		}
+		x, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in zip: %w", f.Name, err)
+		}
+		bodies = append(bodies, x)
+	}
+	if len(bodies) == 0 {
+		return nil, fmt.Errorf("no files in zip body")
+	}
+	return bodies, nil
+}
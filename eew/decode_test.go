@@ -0,0 +1,124 @@
+package eew
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+const (
+	sampleReport = "samples/77_01_01_110311_VXSE45.xml"
+	sampleCancel = "samples/77_01_02_110311_VXSE45.xml"
+)
+
+func readData(t *testing.T, file string) *WebsocketData {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	var data WebsocketData
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("failed to unmarshal fixture: %v", err)
+	}
+	return &data
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		File string
+		Want []string
+	}{
+		{"testdata/data_gzip.json", []string{sampleReport}},
+		{"testdata/data_zip.json", []string{sampleReport, sampleCancel}},
+		{"testdata/data_utf8.json", []string{sampleReport}},
+		{"testdata/data_base64.json", []string{sampleCancel}},
+		{"testdata/data_null.json", []string{sampleReport}},
+	}
+	for _, tt := range tests {
+		got, err := decode(readData(t, tt.File))
+		if err != nil {
+			t.Errorf("%s: failed to decode: %v", tt.File, err)
+			continue
+		}
+		if len(got) != len(tt.Want) {
+			t.Errorf("%s: bodies got:%d want:%d", tt.File, len(got), len(tt.Want))
+			continue
+		}
+		for i, file := range tt.Want {
+			want, _ := os.ReadFile(file)
+			if !bytes.Equal(got[i], want) {
+				t.Errorf("%s: body %d is not equal to %s", tt.File, i, file)
+			}
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		Encoding    *string
+		Compression *string
+		Body        string
+	}{
+		{str("base64"), str("gzip"), "!!!"},
+		{str("base64"), str("gzip"), "bm90IGd6aXA="},
+		{str("base64"), str("zip"), "bm90IHppcA=="},
+		{str("utf-8"), str("gzip"), "<Report/>"},
+		{nil, str("gzip"), "<Report/>"},
+		{str("base64"), str("lzma"), ""},
+		{str("shift_jis"), nil, ""},
+	}
+	for _, tt := range tests {
+		data := WebsocketData{
+			Encoding:    tt.Encoding,
+			Compression: tt.Compression,
+			Body:        tt.Body,
+		}
+		if _, err := decode(&data); err == nil {
+			t.Errorf("no error for encoding:%s compression:%s body:%s", deref(tt.Encoding), deref(tt.Compression), tt.Body)
+		}
+	}
+}
+
+type fakeArchiver struct {
+	bodies []int
+}
+
+func (a *fakeArchiver) Archive(data *WebsocketData, bodies [][]byte) error {
+	a.bodies = append(a.bodies, len(bodies))
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	a := &fakeArchiver{}
+	c := NewClient("key", WithArchiver(a))
+	bus := NewBus()
+	sub := bus.Subscribe("VXSE")
+
+	if err := c.publish(context.Background(), bus, readData(t, "testdata/data_zip.json")); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := sub.Recv(); err != nil {
+			t.Fatalf("failed to recv: %v", err)
+		}
+	}
+
+	// デコードできなくても保存はする
+	broken := readData(t, "testdata/data_gzip.json")
+	broken.Body = "!!!"
+	if err := c.publish(context.Background(), bus, broken); err == nil {
+		t.Errorf("no error for broken body")
+	}
+	bus.Close()
+	if _, err := sub.Recv(); !errors.Is(err, ErrClosed) {
+		t.Errorf("unexpected telegram: %v", err)
+	}
+	if got, want := a.bodies, []int{2, 0}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("archived got:%v want:%v", got, want)
+	}
+}
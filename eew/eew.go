@@ -2,9 +2,7 @@ package eew
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,17 +11,52 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-zeromq/zmq4"
 	"golang.org/x/exp/slog"
 	"golang.org/x/net/websocket"
 )
 
 const (
-	socketUrl      = "https://api.dmdata.jp/v2/socket"
-	classification = "eew.forecast"
+	DefaultApiBase = "https://api.dmdata.jp"
 	contentType    = "application/json"
 )
 
+// DMDATA.JPの区分
+const (
+	// 緊急地震速報（予報）VXSE44/VXSE45
+	ClassificationForecast = "eew.forecast"
+	// 緊急地震速報（警報）VXSE43
+	ClassificationWarning = "eew.warning"
+	// 地震・津波関連。namazuは地震情報VXSE51/VXSE52/VXSE53と津波VTSE41/VTSE51のみ扱う
+	ClassificationEarthquake = "telegram.earthquake"
+)
+
+// classifications は電文種別ごとの区分
+var classifications = map[string]string{
+	"VXSE43": ClassificationWarning,
+	"VXSE44": ClassificationForecast,
+	"VXSE45": ClassificationForecast,
+	"VXSE51": ClassificationEarthquake,
+	"VXSE52": ClassificationEarthquake,
+	"VXSE53": ClassificationEarthquake,
+	"VTSE41": ClassificationEarthquake,
+	"VTSE51": ClassificationEarthquake,
+}
+
+// ClassificationOf は電文種別typの区分を返す。扱わない種別なら空
+func ClassificationOf(typ string) string {
+	return classifications[typ]
+}
+
+// IsClassification はnamazuが扱える区分かどうか
+func IsClassification(c string) bool {
+	for _, v := range classifications {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
 type SocketRequest struct {
 	Classifications []string `json:"classifications"`
 	Types           []string `json:"types,omitempty"`
@@ -142,81 +175,246 @@ func ParseSocketResponse(resp io.Reader) (*SocketResponse, error) {
 	return nil, fmt.Errorf("unknown response: %v", s)
 }
 
-func Run(apiKey, zmqEndpoint string) error {
-	if apiKey == "" {
+// Sender は受信した電文の送り先
+type Sender interface {
+	Send(ctx context.Context, t Telegram) error
+}
+
+// Client はDMDATA.JPのWebSocketから受け取った電文をSenderへ流す
+type Client struct {
+	apiKey     string
+	apiBase    string
+	formatMode string
+	archiver   Archiver
+	httpClient *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// 受け取る区分
+	classifications []string
+}
+
+// ClientOption はClientの設定を変更する
+type ClientOption func(c *Client)
+
+// WithApiBase は接続先のAPIを変更する。空ならDefaultApiBase
+func WithApiBase(apiBase string) ClientOption {
+	return func(c *Client) {
+		if apiBase != "" {
+			c.apiBase = strings.TrimRight(apiBase, "/")
+		}
+	}
+}
+
+// WithFormat は受け取る電文の形式を指定する。xml（既定）またはjson
+func WithFormat(format string) ClientOption {
+	return func(c *Client) {
+		if format == "json" {
+			c.formatMode = "json"
+		} else {
+			c.formatMode = "raw"
+		}
+	}
+}
+
+// WithClassifications は受け取る区分を指定する。空ならeew.forecastのみ
+func WithClassifications(classifications ...string) ClientOption {
+	return func(c *Client) {
+		if len(classifications) > 0 {
+			c.classifications = classifications
+		}
+	}
+}
+
+// Archiver は受信した電文を保存する
+type Archiver interface {
+	// bodiesはデコード済みの電文。デコードできなかった場合はnil
+	Archive(data *WebsocketData, bodies [][]byte) error
+}
+
+// WithArchiver は受信した電文をすべてaへ保存する
+func WithArchiver(a Archiver) ClientOption {
+	return func(c *Client) {
+		c.archiver = a
+	}
+}
+
+func NewClient(apiKey string, opts ...ClientOption) *Client {
+	c := &Client{
+		apiKey:          apiKey,
+		apiBase:         DefaultApiBase,
+		formatMode:      "raw",
+		classifications: []string{ClassificationForecast},
+		httpClient:      http.DefaultClient,
+		minBackoff:      time.Second,
+		maxBackoff:      5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run はZeroMQのPUBソケットへ電文を流す
+func Run(ctx context.Context, apiKey, zmqEndpoint string, opts ...ClientOption) error {
+	// PUBソケットはプロセスが終わるまで使い回す
+	pub, err := Listen(ctx, zmqEndpoint)
+	if err != nil {
+		return err
+	}
+	defer pub.Close()
+	return NewClient(apiKey, opts...).Run(ctx, pub)
+}
+
+// Run はctxがキャンセルされるまでWebSocketへの接続を繰り返す
+func (c *Client) Run(ctx context.Context, s Sender) error {
+	if c.apiKey == "" {
 		return fmt.Errorf("no api key")
 	}
+
+	b := newBackoff(c.minBackoff, c.maxBackoff)
+	for {
+		started, err := c.session(ctx, s)
+		if ctx.Err() != nil {
+			slog.Info("Shutdown", slog.Any("cause", context.Cause(ctx)))
+			return nil
+		}
+		if err != nil {
+			slog.Error("Failed to keep session", err)
+		}
+		// startまで到達していれば正常に繋がっていたとみなす
+		if started {
+			b.Reset()
+		}
+		d := b.Next()
+		slog.Info("Reconnect...", slog.Any("wait", d))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			slog.Info("Shutdown", slog.Any("cause", context.Cause(ctx)))
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) openSocket(ctx context.Context) (*SocketResponse, error) {
 	sreq := SocketRequest{
-		Classifications: []string{classification},
+		Classifications: c.classifications,
 		Test:            "including",
+		FormatMode:      c.formatMode,
 	}
 	j, err := json.Marshal(sreq)
 	if err != nil {
 		slog.Error("Failed to marshal SocketRequest", err, slog.Any("sreq", sreq))
-		return err
+		return nil, err
 	}
 
+	socketUrl := c.apiBase + "/v2/socket"
 	u, err := url.Parse(socketUrl)
 	if err != nil {
 		slog.Error("Failed to parse socket url", err, slog.Any("url", socketUrl))
-		return err
+		return nil, err
 	}
 	q := u.Query()
-	q.Set("key", apiKey)
+	q.Set("key", c.apiKey)
 	u.RawQuery = q.Encode()
-	slog.Info("Connect to get socketStart", slog.Any("url", u), slog.Any("contentType", contentType), slog.Any("json", j))
-	resp, err := http.Post(u.String(), contentType, bytes.NewReader(j))
+	slog.Info("Connect to get socketStart", slog.Any("url", socketUrl), slog.Any("contentType", contentType), slog.Any("json", j))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(j))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		slog.Error("Failed to post SocketRequest", err)
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	sres, err := ParseSocketResponse(resp.Body)
 	if err != nil {
 		slog.Error("Failed to parse SocketResponse", err)
-		return err
+		return nil, err
 	}
 	slog.Info("Succeed to get response", slog.Any("sres", sres))
+	return sres, nil
+}
+
+func (c *Client) closeSocket(ctx context.Context, id int) error {
+	u, err := url.Parse(fmt.Sprintf("%s/v2/socket/%d", c.apiBase, id))
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("key", c.apiKey)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if _, err := ParseSocketResponse(res.Body); err != nil {
+		return err
+	}
+	slog.Info("Succeed to close socket", slog.Any("id", id))
+	return nil
+}
+
+// session はWebSocketを1本張って切断されるまで受信を続ける
+func (c *Client) session(ctx context.Context, s Sender) (started bool, err error) {
+	sres, err := c.openSocket(ctx)
+	if err != nil {
+		return false, err
+	}
 	defer func(id int) {
-		socketCloseUrl := fmt.Sprintf("%s/%d", socketUrl, id)
-		req, err := http.NewRequest("DELETE", socketCloseUrl, nil)
-		if err != nil {
-			slog.Error("Failed to generate request for socketClose", err, slog.Any("url", socketCloseUrl))
-		}
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			slog.Error("Failed to close socket", err, slog.Any("url", socketCloseUrl))
+		// 終了時のctxはキャンセル済みのことがあるので切り離す
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if err := c.closeSocket(ctx, id); err != nil {
+			slog.Error("Failed to close socket", err, slog.Any("id", id))
 		}
-		res.Body.Close()
 	}(sres.Websocket.Id)
 
+	if len(sres.Websocket.Protocol) == 0 {
+		return false, fmt.Errorf("no websocket protocol")
+	}
 	wsUrl := sres.Websocket.Url
 	protocol := sres.Websocket.Protocol[0]
 	origin := "http://localhost"
 	slog.Info("Connect to websocket", slog.Any("url", wsUrl), slog.Any("protocol", protocol), slog.Any("origin", origin))
-	ws, err := websocket.Dial(wsUrl, protocol, origin)
+	config, err := websocket.NewConfig(wsUrl, origin)
+	if err != nil {
+		return false, err
+	}
+	config.Protocol = []string{protocol}
+	ws, err := config.DialContext(ctx)
 	if err != nil {
 		slog.Error("Failed to dial websocket", err)
-		return err
+		return false, err
 	}
 	defer ws.Close()
 	slog.Info("Succeed to connect websocket", slog.Any("ws", ws))
 
-	ctx := context.Background()
-	pub := zmq4.NewPub(ctx)
-	defer pub.Close()
-	if err := pub.Listen(zmqEndpoint); err != nil {
-		slog.Error("Failed to listen zmq4 pubsub", err)
-		return err
-	}
-	slog.Info("Succeed to listen zmq4 pubsub", slog.Any("endpoint", zmqEndpoint))
+	// ctxがキャンセルされたら受信待ちを解除する
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-done:
+		}
+	}()
 
 	for {
 		var b []byte
 		if err := websocket.Message.Receive(ws, &b); err != nil {
-			slog.Error("Failed to receive websocket message", err)
 			// 閉じられたと判断して再接続
-			break
+			return started, fmt.Errorf("failed to receive websocket message: %w", err)
 		}
 		var checkType WebsocketType
 		if err := json.Unmarshal(b, &checkType); err != nil {
@@ -233,6 +431,7 @@ func Run(apiKey, zmqEndpoint string) error {
 				slog.Error("Failed to unmarshal start message", err)
 				continue
 			}
+			started = true
 			slog.Info("Succeed to start websocket", slog.Any("start", start))
 		case "ping":
 			var ping WebsocketPing
@@ -252,56 +451,46 @@ func Run(apiKey, zmqEndpoint string) error {
 				slog.Error("Failed to unmarshal data message", err)
 				continue
 			}
-			var r io.Reader
-			switch *data.Encoding {
-			case "base64":
-				b, err := base64.StdEncoding.DecodeString(data.Body)
-				if err != nil {
-					slog.Error("Failed to decode base64 data.Body", err, slog.Any("base64", data.Body))
-					continue
-				}
-				r = bytes.NewReader(b)
-			case "utf-8":
-				r = strings.NewReader(data.Body)
-			default:
-				slog.Warn("unknown encoding", slog.Any("encoding", data.Encoding))
+			if err := c.publish(ctx, s, &data); err != nil {
+				slog.Error("Failed to publish data", err)
 				continue
 			}
-			switch *data.Compression {
-			case "gzip":
-				var err error
-				r, err = gzip.NewReader(r)
-				if err != nil {
-					slog.Error("Failed to uncompress gzip data", err)
-					continue
-				}
-			case "zip":
-				slog.Warn("zip is not supported", slog.Any("compression", data.Compression))
-				continue
-			}
-			x, err := io.ReadAll(r)
-			if err != nil {
-				slog.Error("Failed to ReadAll xml", err)
-			}
-			msg := zmq4.NewMsgFrom([]byte(data.Head.Type), x)
-			if err := pub.Send(msg); err != nil {
-				slog.Error("Failed to send zmq", err)
-				continue
-			}
-			slog.Info("Succeed to send zmq")
+			slog.Info("Succeed to send telegram")
 		case "error":
 			var e WebsocketError
 			if err := json.Unmarshal(b, &e); err != nil {
-				slog.Error("Failed to unmarshal ping message", err)
+				slog.Error("Failed to unmarshal error message", err)
 				continue
 			}
 			slog.Warn("Received error message", slog.Any("error", e))
 			if e.Close {
-				return nil
+				return started, fmt.Errorf("closed by server: code:%d error:%s", e.Code, e.Error)
 			}
 		default:
 			slog.Warn("unknown type", slog.Any("type", checkType.Type))
 		}
 	}
+}
+
+func (c *Client) publish(ctx context.Context, s Sender, data *WebsocketData) error {
+	bodies, err := decode(data)
+	if c.archiver != nil {
+		if err := c.archiver.Archive(data, bodies); err != nil {
+			slog.Error("Failed to archive telegram", err, slog.Any("id", data.Id))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, body := range bodies {
+		t := Telegram{
+			Type: data.Head.Type,
+			Body: body,
+			Test: data.Head.Test,
+		}
+		if err := s.Send(ctx, t); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,581 @@
+package eew
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Language は投稿文の言語。ISO 639-1の言語コードで、そのままMastodonなどの言語タグに使う
+type Language string
+
+const (
+	LanguageJapanese Language = "ja"
+	LanguageEnglish  Language = "en"
+	LanguageChinese  Language = "zh"
+	LanguageKorean   Language = "ko"
+)
+
+// Languages は投稿文に使える言語
+var Languages = []Language{LanguageJapanese, LanguageEnglish, LanguageChinese, LanguageKorean}
+
+// ParseLanguage は言語コードを変換する。空ならja
+func ParseLanguage(s string) (Language, error) {
+	if s == "" {
+		return LanguageJapanese, nil
+	}
+	l := Language(strings.ToLower(s))
+	if !slices.Contains(Languages, l) {
+		return "", fmt.Errorf("unsupported language: %s", s)
+	}
+	return l, nil
+}
+
+// jst は日本語以外で時刻を書くときのタイムゾーン
+var jst = time.FixedZone("JST", 9*60*60)
+
+// locale は日本語以外の言語での書き方
+type locale struct {
+	// 区域名の区切り
+	sep     string
+	unknown string
+	// 震度。%sは"6+"などを訳したもの
+	intensity     string
+	intensityOver string
+	upper, lower  string
+	// 長周期地震動階級
+	lg     string
+	lgOver string
+	// 震源の深さ。%sはkm単位の数値
+	depth string
+	// 緯度経度。北緯などの接頭辞と数値を緯度、経度の順に渡す
+	latLng                   string
+	north, south, east, west string
+	// 時刻のレイアウト
+	time  string
+	clock string
+	// 津波の到達予想時刻。%sはclockで書式化したもの
+	arrival string
+	// 津波の高さ。"８．５ｍ以上"、"１０ｍ超"
+	heightOrMore string
+	heightOver   string
+	// 津波の警報・注意報・予報の種類。TsunamiNoneからの順
+	tsunami []string
+	// 区域名の接尾辞。"宮城県"+"北部"など
+	suffixes map[string]string
+	// 区域名の接頭辞と続き。"千葉県"+"内房"など
+	join string
+	// "宮城"のように県を省いた名前で取り除くもの
+	prefSuffixes []string
+	// 電文の見出しや状況など決まった言い回し
+	phrases map[string]string
+}
+
+var locales = map[Language]*locale{
+	LanguageEnglish: {
+		sep:           ", ",
+		unknown:       "unknown",
+		intensity:     "Shindo %s",
+		intensityOver: "Shindo %s or higher",
+		upper:         " Upper",
+		lower:         " Lower",
+		lg:            "long-period ground motion class %s",
+		lgOver:        "long-period ground motion class %s or higher",
+		depth:         "about %s km",
+		latLng:        "%[2]s°%[1]s, %[4]s°%[3]s",
+		north:         "N",
+		south:         "S",
+		east:          "E",
+		west:          "W",
+		time:          "Jan 2 15:04 MST",
+		clock:         "15:04",
+		arrival:       "expected at %s",
+		heightOrMore:  "%s or more",
+		heightOver:    "over %s",
+		tsunami:       []string{"No Tsunami", "Tsunami Forecast", "Tsunami Advisory", "Tsunami Warning", "Major Tsunami Warning"},
+		suffixes: map[string]string{
+			"北部": "Northern %s", "南部": "Southern %s", "東部": "Eastern %s", "西部": "Western %s", "中部": "Central %s",
+			"北東部": "Northeastern %s", "北西部": "Northwestern %s", "南東部": "Southeastern %s", "南西部": "Southwestern %s",
+			"中東部": "Central-eastern %s", "中北部": "Central-northern %s", "中・西部": "Central and Western %s",
+			"沿岸": "Coast of %s", "内陸": "Inland %s", "地方": "%s Region",
+			"太平洋沿岸": "Pacific Coast of %s", "日本海沿岸": "Sea of Japan Coast of %s",
+			"オホーツク海沿岸": "Sea of Okhotsk Coast of %s", "瀬戸内海沿岸": "Seto Inland Sea Coast of %s",
+			"沖": "Off %s", "東方沖": "Off the East Coast of %s", "西方沖": "Off the West Coast of %s",
+			"南方沖": "Off the South Coast of %s", "北方沖": "Off the North Coast of %s",
+			"北東沖": "Northeast Off %s", "南東沖": "Southeast Off %s", "北西沖": "Northwest Off %s", "南西沖": "Southwest Off %s",
+			"近海": "Near %s", "付近": "Near %s",
+		},
+		join:         "%[2]s, %[1]s",
+		prefSuffixes: []string{" Prefecture"},
+		phrases: map[string]string{
+			"緊急地震速報（地震動予報）": "Earthquake Early Warning (Forecast)",
+			TitleWarning:        "Earthquake Early Warning (Warning)",
+			TitleIntensity:      "Seismic Intensity Report",
+			TitleHypocenter:     "Hypocenter Information",
+			TitleEarthquake:     "Hypocenter and Seismic Intensity Information",
+			TitleTsunamiWarning: "Tsunami Warning/Advisory/Forecast",
+			TitleTsunamiInfo:    "Tsunami Information",
+			"Ｍ８を超える巨大地震":        "over 8",
+			"ただちに津波来襲と予測":       "arriving immediately",
+			"津波到達中と推測":          "arriving now",
+			"第１波の到達を確認":         "first wave observed",
+			"巨大":                "huge",
+			"高い":                "high",
+			"微弱":                "slight",
+			"この地震による津波の心配はありません。":                            "There is no tsunami threat from this earthquake.",
+			"津波警報等（大津波警報・津波警報あるいは津波注意報）を発表中です。":              "Tsunami warnings or advisories are in effect.",
+			"今後の情報に注意してください。":                                "Pay attention to further information.",
+			"この地震により、日本の沿岸では若干の海面変動があるかもしれませんが、被害の心配はありません。": "Slight sea level changes may occur on the coasts of Japan, but no damage is expected.",
+		},
+	},
+	LanguageChinese: {
+		sep:           "、",
+		unknown:       "不明",
+		intensity:     "震度%s",
+		intensityOver: "震度%s以上",
+		upper:         "强",
+		lower:         "弱",
+		lg:            "长周期地震动阶级%s",
+		lgOver:        "长周期地震动阶级%s以上",
+		depth:         "约%s公里",
+		latLng:        "%s%s度、%s%s度",
+		north:         "北纬",
+		south:         "南纬",
+		east:          "东经",
+		west:          "西经",
+		time:          "2日15时04分",
+		clock:         "15时04分",
+		arrival:       "预计%s到达",
+		heightOrMore:  "%s以上",
+		heightOver:    "超过%s",
+		tsunami:       []string{"无海啸", "海啸预报", "海啸注意报", "海啸警报", "大海啸警报"},
+		suffixes: map[string]string{
+			"北部": "%s北部", "南部": "%s南部", "東部": "%s东部", "西部": "%s西部", "中部": "%s中部",
+			"北東部": "%s东北部", "北西部": "%s西北部", "南東部": "%s东南部", "南西部": "%s西南部",
+			"中東部": "%s中东部", "中北部": "%s中北部", "中・西部": "%s中・西部",
+			"沿岸": "%s沿岸", "内陸": "%s内陆", "地方": "%s地方",
+			"太平洋沿岸": "%s太平洋沿岸", "日本海沿岸": "%s日本海沿岸",
+			"オホーツク海沿岸": "%s鄂霍次克海沿岸", "瀬戸内海沿岸": "%s濑户内海沿岸",
+			"沖": "%s近海", "東方沖": "%s以东近海", "西方沖": "%s以西近海",
+			"南方沖": "%s以南近海", "北方沖": "%s以北近海",
+			"北東沖": "%s东北近海", "南東沖": "%s东南近海", "北西沖": "%s西北近海", "南西沖": "%s西南近海",
+			"近海": "%s近海", "付近": "%s附近",
+		},
+		join:         "%s%s",
+		prefSuffixes: []string{"县", "府", "都"},
+		phrases: map[string]string{
+			"緊急地震速報（地震動予報）": "紧急地震速报（预报）",
+			TitleWarning:        "紧急地震速报（警报）",
+			TitleIntensity:      "震度速报",
+			TitleHypocenter:     "震源相关信息",
+			TitleEarthquake:     "震源与震度相关信息",
+			TitleTsunamiWarning: "海啸警报・注意报・预报",
+			TitleTsunamiInfo:    "海啸信息",
+			"Ｍ８を超える巨大地震":        "超过8",
+			"ただちに津波来襲と予測":       "预计海啸立即来袭",
+			"津波到達中と推測":          "推测海啸正在到达",
+			"第１波の到達を確認":         "已确认第一波到达",
+			"巨大":                "巨大",
+			"高い":                "高",
+			"微弱":                "微弱",
+			"この地震による津波の心配はありません。":                            "此次地震不会引发海啸。",
+			"津波警報等（大津波警報・津波警報あるいは津波注意報）を発表中です。":              "目前已发布海啸警报或注意报。",
+			"今後の情報に注意してください。":                                "请留意后续信息。",
+			"この地震により、日本の沿岸では若干の海面変動があるかもしれませんが、被害の心配はありません。": "此次地震可能使日本沿岸海面略有变化，但不会造成灾害。",
+		},
+	},
+	LanguageKorean: {
+		sep:           ", ",
+		unknown:       "불명",
+		intensity:     "진도 %s",
+		intensityOver: "진도 %s 이상",
+		upper:         "강",
+		lower:         "약",
+		lg:            "장주기 지진동 계급 %s",
+		lgOver:        "장주기 지진동 계급 %s 이상",
+		depth:         "약 %skm",
+		latLng:        "%s %s도, %s %s도",
+		north:         "북위",
+		south:         "남위",
+		east:          "동경",
+		west:          "서경",
+		time:          "2일 15시 04분",
+		clock:         "15시 04분",
+		arrival:       "%s 도달 예상",
+		heightOrMore:  "%s 이상",
+		heightOver:    "%s 초과",
+		tsunami:       []string{"쓰나미 없음", "쓰나미 예보", "쓰나미 주의보", "쓰나미 경보", "대형 쓰나미 경보"},
+		suffixes: map[string]string{
+			"北部": "%s 북부", "南部": "%s 남부", "東部": "%s 동부", "西部": "%s 서부", "中部": "%s 중부",
+			"北東部": "%s 북동부", "北西部": "%s 북서부", "南東部": "%s 남동부", "南西部": "%s 남서부",
+			"中東部": "%s 중동부", "中北部": "%s 중북부", "中・西部": "%s 중·서부",
+			"沿岸": "%s 연안", "内陸": "%s 내륙", "地方": "%s 지방",
+			"太平洋沿岸": "%s 태평양 연안", "日本海沿岸": "%s 동해 연안",
+			"オホーツク海沿岸": "%s 오호츠크해 연안", "瀬戸内海沿岸": "%s 세토내해 연안",
+			"沖": "%s 앞바다", "東方沖": "%s 동쪽 앞바다", "西方沖": "%s 서쪽 앞바다",
+			"南方沖": "%s 남쪽 앞바다", "北方沖": "%s 북쪽 앞바다",
+			"北東沖": "%s 북동쪽 앞바다", "南東沖": "%s 남동쪽 앞바다", "北西沖": "%s 북서쪽 앞바다", "南西沖": "%s 남서쪽 앞바다",
+			"近海": "%s 근해", "付近": "%s 부근",
+		},
+		join:         "%s %s",
+		prefSuffixes: []string{"현", "부", "도"},
+		phrases: map[string]string{
+			"緊急地震速報（地震動予報）": "긴급지진속보(예보)",
+			TitleWarning:        "긴급지진속보(경보)",
+			TitleIntensity:      "진도 속보",
+			TitleHypocenter:     "진원에 관한 정보",
+			TitleEarthquake:     "진원·진도에 관한 정보",
+			TitleTsunamiWarning: "쓰나미 경보·주의보·예보",
+			TitleTsunamiInfo:    "쓰나미 정보",
+			"Ｍ８を超える巨大地震":        "8 초과",
+			"ただちに津波来襲と予測":       "즉시 내습 예측",
+			"津波到達中と推測":          "도달 중으로 추정",
+			"第１波の到達を確認":         "제1파 도달 확인",
+			"巨大":                "거대",
+			"高い":                "높음",
+			"微弱":                "미약",
+			"この地震による津波の心配はありません。":                            "이 지진으로 인한 쓰나미 우려는 없습니다.",
+			"津波警報等（大津波警報・津波警報あるいは津波注意報）を発表中です。":              "쓰나미 경보 또는 주의보가 발표 중입니다.",
+			"今後の情報に注意してください。":                                "앞으로의 정보에 주의하십시오.",
+			"この地震により、日本の沿岸では若干の海面変動があるかもしれませんが、被害の心配はありません。": "이 지진으로 일본 연안에서 약간의 해수면 변동이 있을 수 있으나 피해 우려는 없습니다.",
+		},
+	},
+}
+
+//go:embed locales/areas.tsv
+var areasTsv string
+
+// areaNames は地域名の対訳。コードは区域の種類ごとに重複するため名前で引く
+var areaNames = mustAreaNames()
+
+func mustAreaNames() map[string]map[Language]string {
+	m := make(map[string]map[Language]string)
+	s := bufio.NewScanner(strings.NewReader(areasTsv))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) != 4 {
+			panic(fmt.Sprintf("invalid line in areas.tsv: %q", line))
+		}
+		m[cols[0]] = map[Language]string{
+			LanguageEnglish: cols[1],
+			LanguageChinese: cols[2],
+			LanguageKorean:  cols[3],
+		}
+	}
+	return m
+}
+
+func (l Language) locale() *locale {
+	return locales[l]
+}
+
+// AreaName は震央地名や予報区の名前を訳す。訳せなければそのまま返す
+func (l Language) AreaName(name string) string {
+	lc := l.locale()
+	if lc == nil {
+		return name
+	}
+	if s, ok := lc.area(l, name); ok {
+		return s
+	}
+	// "宮城"のように県を省いた府県予報区
+	for _, suffix := range []string{"県", "府", "都"} {
+		if s, ok := lc.area(l, name+suffix); ok {
+			for _, ps := range lc.prefSuffixes {
+				s = strings.TrimSuffix(s, ps)
+			}
+			return s
+		}
+	}
+	return name
+}
+
+// area は対訳表の名前に接尾辞や接頭辞を組み合わせて訳す
+func (lc *locale) area(l Language, name string) (string, bool) {
+	if names, ok := areaNames[name]; ok {
+		return names[l], true
+	}
+	// 長い接尾辞を優先する
+	var suffix string
+	for s := range lc.suffixes {
+		if len(s) > len(suffix) && len(s) < len(name) && strings.HasSuffix(name, s) {
+			if _, ok := lc.area(l, strings.TrimSuffix(name, s)); ok {
+				suffix = s
+			}
+		}
+	}
+	if suffix != "" {
+		base, _ := lc.area(l, strings.TrimSuffix(name, suffix))
+		return fmt.Sprintf(lc.suffixes[suffix], base), true
+	}
+	var prefix string
+	for p := range areaNames {
+		if len(p) > len(prefix) && len(p) < len(name) && strings.HasPrefix(name, p) {
+			if _, ok := lc.area(l, strings.TrimPrefix(name, p)); ok {
+				prefix = p
+			}
+		}
+	}
+	if prefix != "" {
+		rest, _ := lc.area(l, strings.TrimPrefix(name, prefix))
+		return fmt.Sprintf(lc.join, areaNames[prefix][l], rest), true
+	}
+	return "", false
+}
+
+// Names は区域名を訳して並べる
+func (l Language) Names(areas []WarningArea) string {
+	lc := l.locale()
+	if lc == nil {
+		return names(areas)
+	}
+	s := make([]string, 0, len(areas))
+	for _, a := range areas {
+		s = append(s, l.AreaName(a.Name))
+	}
+	return strings.Join(s, lc.sep)
+}
+
+// intensityClass は"6+"を"6 Upper"のようにする
+func (lc *locale) intensityClass(class string) string {
+	if v, ok := strings.CutSuffix(class, "+"); ok {
+		return v + lc.upper
+	}
+	if v, ok := strings.CutSuffix(class, "-"); ok {
+		return v + lc.lower
+	}
+	return class
+}
+
+// Intensity は震度を書く。vは"6+"のような震度階級か*Intensity
+func (l Language) Intensity(v any) (string, error) {
+	lc := l.locale()
+	switch i := v.(type) {
+	case string:
+		if lc == nil {
+			return intensityName(i), nil
+		}
+		if i == "" {
+			return fmt.Sprintf(lc.intensity, lc.unknown), nil
+		}
+		return fmt.Sprintf(lc.intensity, lc.intensityClass(i)), nil
+	case *Intensity:
+		if lc == nil {
+			return i.String(), nil
+		}
+		if i == nil {
+			return fmt.Sprintf(lc.intensity, lc.unknown), nil
+		}
+		if i.To == "over" {
+			return fmt.Sprintf(lc.intensityOver, lc.intensityClass(i.From)), nil
+		}
+		return fmt.Sprintf(lc.intensity, lc.intensityClass(i.To)), nil
+	}
+	return "", fmt.Errorf("intensity: unsupported type %T", v)
+}
+
+// LgIntensity は長周期地震動階級を書く。vは"3"のような階級か*Intensity
+func (l Language) LgIntensity(v any) (string, error) {
+	var i *Intensity
+	switch t := v.(type) {
+	case string:
+		i = &Intensity{From: t, To: t}
+	case *Intensity:
+		i = t
+	default:
+		return "", fmt.Errorf("lgIntensity: unsupported type %T", v)
+	}
+	lc := l.locale()
+	switch {
+	case lc == nil:
+		return i.LgString(), nil
+	case i == nil:
+		return fmt.Sprintf(lc.lg, lc.unknown), nil
+	case i.To == "over":
+		return fmt.Sprintf(lc.lgOver, i.From), nil
+	}
+	return fmt.Sprintf(lc.lg, i.To), nil
+}
+
+// Depth は震源の深さを書く
+func (l Language) Depth(d *Depth) string {
+	lc := l.locale()
+	if lc == nil {
+		return d.String()
+	}
+	if d == nil {
+		return lc.unknown
+	}
+	// 0kmは10kmとして扱う。Depth.Stringを参照
+	v := math.Abs(float64(*d))
+	if v == 0 {
+		v = 10000
+	}
+	return fmt.Sprintf(lc.depth, strconv.FormatFloat(v/1000, 'f', -1, 64))
+}
+
+// LatLng は震央の緯度経度を書く
+func (l Language) LatLng(ll *LatLng) string {
+	lc := l.locale()
+	if lc == nil {
+		return ll.String()
+	}
+	if ll == nil {
+		return lc.unknown
+	}
+	ns, ew := lc.north, lc.east
+	if ll.Lat < 0 {
+		ns = lc.south
+	}
+	if ll.Lng < 0 {
+		ew = lc.west
+	}
+	lat := strconv.FormatFloat(math.Abs(ll.Lat), 'f', -1, 64)
+	lng := strconv.FormatFloat(math.Abs(ll.Lng), 'f', -1, 64)
+	return fmt.Sprintf(lc.latLng, ns, lat, ew, lng)
+}
+
+// Magnitude はマグニチュードを書く
+func (l Language) Magnitude(m *Magnitude) string {
+	lc := l.locale()
+	if lc == nil {
+		return m.String()
+	}
+	if _, ok := m.Float(); ok {
+		return m.String()
+	}
+	if m == nil || m.Condition == MagnitudeConditionUnknown {
+		return lc.unknown
+	}
+	return l.Phrase(m.Condition)
+}
+
+// Time は発生時刻などを書く。vはtime.Time、*time.Time、*ReportTime
+func (l Language) Time(v any) (string, error) {
+	lc := l.locale()
+	if lc == nil {
+		return formatTime("_2日15時04分", v)
+	}
+	t, err := toTime(v)
+	if err != nil || t == nil {
+		return lc.unknown, err
+	}
+	return t.In(jst).Format(lc.time), nil
+}
+
+// Clock は時刻のみを書く
+func (l Language) Clock(t time.Time) string {
+	lc := l.locale()
+	if lc == nil {
+		return t.Format("15時04分")
+	}
+	return t.In(jst).Format(lc.clock)
+}
+
+// Phrase は電文の見出しや状況など決まった言い回しを訳す。訳せなければそのまま返す
+func (l Language) Phrase(s string) string {
+	lc := l.locale()
+	if lc == nil {
+		return s
+	}
+	if v, ok := lc.phrases[s]; ok {
+		return v
+	}
+	return s
+}
+
+// Comment は固定付加文を訳す。訳せない文が含まれていれば空を返す
+func (l Language) Comment(s string) string {
+	lc := l.locale()
+	if lc == nil {
+		return s
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		for _, sentence := range strings.SplitAfter(line, "。") {
+			if sentence == "" {
+				continue
+			}
+			v, ok := lc.phrases[sentence]
+			if !ok {
+				return ""
+			}
+			if b.Len() > 0 && l != LanguageChinese {
+				b.WriteString(" ")
+			}
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// TsunamiCategory は津波の警報・注意報・予報の種類を書く
+func (l Language) TsunamiCategory(c TsunamiCategory) string {
+	lc := l.locale()
+	if lc == nil || int(c) >= len(lc.tsunami) {
+		return c.String()
+	}
+	return lc.tsunami[c]
+}
+
+// TsunamiHeight は津波の高さを書く
+func (l Language) TsunamiHeight(h *TsunamiHeight) string {
+	lc := l.locale()
+	if lc == nil {
+		return h.String()
+	}
+	if h == nil {
+		return lc.unknown
+	}
+	if h.Description == "" {
+		if math.IsNaN(h.Value) {
+			return lc.unknown
+		}
+		return strconv.FormatFloat(h.Value, 'f', -1, 64) + "m"
+	}
+	if v, ok := lc.phrases[h.Description]; ok {
+		return v
+	}
+	d := halfWidth(h.Description)
+	if v, ok := strings.CutSuffix(d, "以上"); ok {
+		return fmt.Sprintf(lc.heightOrMore, v)
+	}
+	if v, ok := strings.CutSuffix(d, "超"); ok {
+		return fmt.Sprintf(lc.heightOver, v)
+	}
+	return d
+}
+
+// Arrival は津波の到達予想時刻か、なければ状況を書く
+func (l Language) Arrival(a TsunamiArea) string {
+	lc := l.locale()
+	if lc == nil {
+		return a.Arrival()
+	}
+	if a.Condition != "" {
+		return l.Phrase(a.Condition)
+	}
+	if a.ArrivalTime != nil {
+		return fmt.Sprintf(lc.arrival, l.Clock(*a.ArrivalTime))
+	}
+	return ""
+}
+
+// halfWidth は全角の英数字と記号を半角にする
+func halfWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '！' && r <= '～' {
+			return r - '！' + '!'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,96 @@
+package eew
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		In   string
+		Want Language
+		Err  bool
+	}{
+		{"", LanguageJapanese, false},
+		{"ja", LanguageJapanese, false},
+		{"EN", LanguageEnglish, false},
+		{"zh", LanguageChinese, false},
+		{"ko", LanguageKorean, false},
+		{"fr", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLanguage(tt.In)
+		if (err != nil) != tt.Err || got != tt.Want {
+			t.Errorf("%q: got:%s,%v want:%s", tt.In, got, err, tt.Want)
+		}
+	}
+}
+
+func TestAreaName(t *testing.T) {
+	tests := []struct {
+		Lang Language
+		Name string
+		Want string
+	}{
+		{LanguageJapanese, "三陸沖", "三陸沖"},
+		{LanguageEnglish, "三陸沖", "Off Sanriku"},
+		{LanguageEnglish, "宮城県北部", "Northern Miyagi Prefecture"},
+		{LanguageEnglish, "千葉県東方沖", "Off the East Coast of Chiba Prefecture"},
+		{LanguageEnglish, "岩手県沿岸北部", "Northern Coast of Iwate Prefecture"},
+		{LanguageEnglish, "東京都２３区", "23 Wards, Tokyo"},
+		{LanguageEnglish, "胆振地方中東部", "Central-eastern Iburi Region"},
+		{LanguageEnglish, "北海道太平洋沿岸東部", "Eastern Pacific Coast of Hokkaido"},
+		{LanguageEnglish, "宮城", "Miyagi"},
+		{LanguageEnglish, "東京", "Tokyo"},
+		// 訳せないものはそのまま
+		{LanguageEnglish, "仙台宮城野区", "仙台宮城野区"},
+		{LanguageChinese, "宮城県北部", "宫城县北部"},
+		{LanguageChinese, "宮城", "宫城"},
+		{LanguageChinese, "伊豆大島近海", "伊豆大岛近海"},
+		{LanguageKorean, "宮城県北部", "미야기현 북부"},
+		{LanguageKorean, "千葉県内房", "지바현 우치보"},
+		{LanguageKorean, "宮城", "미야기"},
+	}
+	for _, tt := range tests {
+		if got := tt.Lang.AreaName(tt.Name); got != tt.Want {
+			t.Errorf("%s %s: got:%s want:%s", tt.Lang, tt.Name, got, tt.Want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	d := Depth(-50000)
+	tests := []struct {
+		Got  string
+		Want string
+	}{
+		{mustString(LanguageEnglish.Intensity("5-")), "Shindo 5 Lower"},
+		{mustString(LanguageEnglish.Intensity(&Intensity{From: "6+", To: "over"})), "Shindo 6 Upper or higher"},
+		{mustString(LanguageEnglish.Intensity((*Intensity)(nil))), "Shindo unknown"},
+		{mustString(LanguageKorean.Intensity("6+")), "진도 6강"},
+		{mustString(LanguageJapanese.Intensity("6+")), "震度6強"},
+		{mustString(LanguageChinese.LgIntensity(&Intensity{From: "3", To: "over"})), "长周期地震动阶级3以上"},
+		{LanguageEnglish.Depth(&d), "about 50 km"},
+		{LanguageEnglish.LatLng(&LatLng{Lat: -1.5, Lng: 142.9}), "1.5°S, 142.9°E"},
+		{LanguageEnglish.Magnitude(&Magnitude{Condition: MagnitudeConditionUnknown}), "unknown"},
+		{LanguageEnglish.Magnitude(&Magnitude{Value: 7.0}), "7.0"},
+		{LanguageEnglish.TsunamiHeight(&TsunamiHeight{Value: math.NaN(), Description: "１０ｍ超"}), "over 10m"},
+		{LanguageKorean.TsunamiHeight(&TsunamiHeight{Value: math.NaN(), Description: "巨大"}), "거대"},
+		{LanguageEnglish.TsunamiCategory(TsunamiMajorWarning), "Major Tsunami Warning"},
+		{LanguageEnglish.Comment("今後の情報に注意してください。"), "Pay attention to further information."},
+		// 訳せない文が含まれていれば書かない
+		{LanguageEnglish.Comment("今後の情報に注意してください。不明な文です。"), ""},
+	}
+	for _, tt := range tests {
+		if tt.Got != tt.Want {
+			t.Errorf("got:%s want:%s", tt.Got, tt.Want)
+		}
+	}
+}
+
+func mustString(s string, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return s
+}
@@ -0,0 +1,264 @@
+package eew
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DMDATA.JPのJSON形式（eew-information）
+// https://dmdata.jp/docs/reference/conversion/json/schema/eew-information
+type jsonIntensity struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (i *jsonIntensity) intensity() *Intensity {
+	if i == nil {
+		return nil
+	}
+	return &Intensity{From: i.From, To: i.To}
+}
+
+type jsonValue struct {
+	Type      string  `json:"type"`
+	Unit      string  `json:"unit"`
+	Value     *string `json:"value"`
+	Condition string  `json:"condition"`
+}
+
+type jsonKind struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// jsonWarningArea はisWarningの場合のbody.zones/prefectures/regionsの要素
+type jsonWarningArea struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Kind struct {
+		jsonKind
+		LastKind jsonKind `json:"lastKind"`
+	} `json:"kind"`
+}
+
+func warningAreas(areas []jsonWarningArea) []WarningArea {
+	var w []WarningArea
+	for _, a := range areas {
+		w = append(w, WarningArea{
+			Name:     a.Name,
+			Code:     a.Code,
+			Kind:     Kind{Name: a.Kind.Name, Code: a.Kind.Code},
+			LastKind: Kind{Name: a.Kind.LastKind.Name, Code: a.Kind.LastKind.Code},
+		})
+	}
+	return w
+}
+
+type jsonReport struct {
+	Schema struct {
+		Type    string `json:"type"`
+		Version string `json:"version"`
+	} `json:"_schema"`
+	ReportDateTime time.Time `json:"reportDateTime"`
+	Title          string    `json:"title"`
+	Headline       string    `json:"headline"`
+	Status         string    `json:"status"`
+	InfoType       string    `json:"infoType"`
+	EventId        string    `json:"eventId"`
+	SerialNo       string    `json:"serialNo"`
+	Body           struct {
+		IsLastInfo bool   `json:"isLastInfo"`
+		IsCanceled bool   `json:"isCanceled"`
+		Text       string `json:"text"`
+		Earthquake *struct {
+			Condition   string     `json:"condition"`
+			OriginTime  *time.Time `json:"originTime"`
+			ArrivalTime *time.Time `json:"arrivalTime"`
+			Hypocenter  struct {
+				Code       string `json:"code"`
+				Name       string `json:"name"`
+				Coordinate struct {
+					Latitude *struct {
+						Value string `json:"value"`
+					} `json:"latitude"`
+					Longitude *struct {
+						Value string `json:"value"`
+					} `json:"longitude"`
+					Height *jsonValue `json:"height"`
+				} `json:"coordinate"`
+				Depth  *jsonValue `json:"depth"`
+				Reduce struct {
+					Code string `json:"code"`
+					Name string `json:"name"`
+				} `json:"reduce"`
+				LandOrSea string `json:"landOrSea"`
+				Accuracy  *struct {
+					Epicenters                   []string `json:"epicenters"`
+					Depth                        string   `json:"depth"`
+					MagnitudeCalculation         string   `json:"magnitudeCalculation"`
+					NumberOfMagnitudeCalculation string   `json:"numberOfMagnitudeCalculation"`
+				} `json:"accuracy"`
+			} `json:"hypocenter"`
+			Magnitude jsonValue `json:"magnitude"`
+		} `json:"earthquake"`
+		Intensity *struct {
+			ForecastMaxInt   *jsonIntensity `json:"forecastMaxInt"`
+			ForecastMaxLgInt *jsonIntensity `json:"forecastMaxLgInt"`
+			Regions          []struct {
+				Code             string         `json:"code"`
+				Name             string         `json:"name"`
+				ForecastMaxInt   *jsonIntensity `json:"forecastMaxInt"`
+				ForecastMaxLgInt *jsonIntensity `json:"forecastMaxLgInt"`
+				Kind             jsonKind       `json:"kind"`
+				Condition        string         `json:"condition"`
+				ArrivalTime      *time.Time     `json:"arrivalTime"`
+			} `json:"regions"`
+		} `json:"intensity"`
+		// 地方予報区、府県予報区、細分区域
+		Zones       []jsonWarningArea `json:"zones"`
+		Prefectures []jsonWarningArea `json:"prefectures"`
+		Regions     []jsonWarningArea `json:"regions"`
+	} `json:"body"`
+}
+
+// IsJSON はbodyがJSON形式の電文かどうか
+func IsJSON(body []byte) bool {
+	b := bytes.TrimSpace(body)
+	return len(b) > 0 && b[0] == '{'
+}
+
+// NewContentJSON はDMDATA.JPのJSON形式の電文からNewContentと同じContentを作る
+//
+// JSON形式には府県予報区とマグニチュードのdescriptionが含まれないので、
+// AreasのPrefName/PrefCodeとMagnitude.Descriptionは空になる
+func NewContentJSON(r io.Reader) (*Content, error) {
+	var report jsonReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	if report.Schema.Type != "eew-information" {
+		return nil, fmt.Errorf("unsupported schema: %s", report.Schema.Type)
+	}
+
+	content := Content{
+		EventId:        report.EventId,
+		Title:          report.Title,
+		ReportDateTime: report.ReportDateTime,
+		Status:         report.Status,
+		InfoType:       report.InfoType,
+		Text:           report.Body.Text,
+		Headline:       report.Headline,
+		AreaName:       "不明",
+		IsLast:         IsLast(report.Body.IsLastInfo),
+		Url:            detailUrl(report.EventId),
+	}
+	if report.SerialNo != "" {
+		serial, err := strconv.Atoi(report.SerialNo)
+		if err != nil {
+			return nil, err
+		}
+		content.Serial = Serial(serial)
+	}
+
+	if eq := report.Body.Earthquake; eq != nil {
+		if eq.OriginTime != nil {
+			rt := ReportTime(*eq.OriginTime)
+			content.Time = &rt
+		} else if eq.ArrivalTime != nil {
+			rt := ReportTime(*eq.ArrivalTime)
+			content.Time = &rt
+		}
+		h := eq.Hypocenter
+		if h.Name != "" {
+			content.AreaName = h.Name
+		}
+		content.AreaCode = h.Code
+		content.ReduceName = h.Reduce.Name
+		content.ReduceCode = h.Reduce.Code
+		content.LandOrSea = h.LandOrSea
+		content.HypocenterCondition = eq.Condition
+		if a := h.Accuracy; a != nil {
+			content.Accuracy = &Accuracy{
+				Depth:           HypocenterRank(parseRank(a.Depth)),
+				Magnitude:       MagnitudeRank(parseRank(a.MagnitudeCalculation)),
+				MagnitudePoints: parseRank(a.NumberOfMagnitudeCalculation),
+			}
+			if len(a.Epicenters) > 0 {
+				content.Accuracy.Epicenter = HypocenterRank(parseRank(a.Epicenters[0]))
+			}
+			if len(a.Epicenters) > 1 {
+				content.Accuracy.Epicenter2 = HypocenterRank(parseRank(a.Epicenters[1]))
+			}
+		}
+		if lat, lng := h.Coordinate.Latitude, h.Coordinate.Longitude; lat != nil && lng != nil {
+			latV, err := strconv.ParseFloat(lat.Value, 64)
+			if err != nil {
+				return nil, err
+			}
+			lngV, err := strconv.ParseFloat(lng.Value, 64)
+			if err != nil {
+				return nil, err
+			}
+			content.LatLng = &LatLng{latV, lngV}
+		}
+		// XMLに合わせてメートル単位の高さにする
+		if v := h.Coordinate.Height; v != nil && v.Value != nil {
+			height, err := strconv.ParseFloat(*v.Value, 64)
+			if err != nil {
+				return nil, err
+			}
+			d := Depth(height)
+			content.Depth = &d
+		} else if v := h.Depth; v != nil && v.Value != nil {
+			depth, err := strconv.ParseFloat(*v.Value, 64)
+			if err != nil {
+				return nil, err
+			}
+			d := Depth(-depth * 1000)
+			content.Depth = &d
+		}
+		if v := eq.Magnitude.Value; v != nil {
+			m, err := strconv.ParseFloat(*v, 64)
+			if err != nil {
+				return nil, err
+			}
+			content.Magnitude = &Magnitude{Value: m, Type: eq.Magnitude.Unit}
+		} else if c := eq.Magnitude.Condition; c != "" {
+			// XMLのconditionに合わせる
+			if c == "Ｍ不明" {
+				c = MagnitudeConditionUnknown
+			}
+			content.Magnitude = &Magnitude{Type: eq.Magnitude.Unit, Condition: c}
+		}
+	}
+
+	if i := report.Body.Intensity; i != nil {
+		content.Intensity = i.ForecastMaxInt.intensity()
+		content.LgIntensity = i.ForecastMaxLgInt.intensity()
+		for _, r := range i.Regions {
+			content.Areas = append(content.Areas, ForecastArea{
+				Name:        r.Name,
+				Code:        r.Code,
+				Intensity:   r.ForecastMaxInt.intensity(),
+				LgIntensity: r.ForecastMaxLgInt.intensity(),
+				ArrivalTime: r.ArrivalTime,
+				Kind:        Kind{Name: r.Kind.Name, Code: r.Kind.Code},
+				Condition:   r.Condition,
+			})
+		}
+	}
+
+	if b := report.Body; len(b.Zones)+len(b.Prefectures)+len(b.Regions) > 0 {
+		content.Warning = &Warning{
+			Regions: warningAreas(b.Zones),
+			Prefs:   warningAreas(b.Prefectures),
+			Areas:   warningAreas(b.Regions),
+		}
+	}
+
+	return &content, nil
+}
@@ -0,0 +1,61 @@
+package eew
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestNewContentJSON(t *testing.T) {
+	tests := []string{
+		"samples/77_01_01_110311_VXSE43",
+		"samples/77_01_01_110311_VXSE45",
+		"samples/77_01_02_110311_VXSE45",
+	}
+	for _, tt := range tests {
+		xb, err := os.ReadFile(tt + ".xml")
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", err)
+		}
+		jb, err := os.ReadFile(tt + ".json")
+		if err != nil {
+			t.Fatalf("failed to open sample json: %v", err)
+		}
+		if IsJSON(xb) || !IsJSON(jb) {
+			t.Errorf("%s: failed to detect format", tt)
+		}
+
+		want, err := Telegram{Type: "VXSE45", Body: xb}.Content()
+		if err != nil {
+			t.Fatalf("failed to parse xml: %v", err)
+		}
+		// JSON形式には府県予報区が含まれない
+		for i := range want.Areas {
+			want.Areas[i].PrefName = ""
+			want.Areas[i].PrefCode = ""
+		}
+		if want.Magnitude != nil {
+			want.Magnitude.Description = ""
+		}
+		got, err := Telegram{Type: "VXSE45", Body: jb}.Content()
+		if err != nil {
+			t.Fatalf("failed to parse json: %v", err)
+		}
+
+		// 時刻のLocationが異なるのでJSONにして比べる
+		wantJ, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		gotJ, err := json.Marshal(got)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		if string(gotJ) != string(wantJ) {
+			t.Errorf("%s:\ngot: %s\nwant:%s", tt, gotJ, wantJ)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s:\ngot: %s\nwant:%s", tt, got, want)
+		}
+	}
+}
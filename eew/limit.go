@@ -0,0 +1,154 @@
+package eew
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Count は投稿文の長さの数え方
+type Count int
+
+const (
+	// コードポイント数。Mastodonなど
+	CountRunes Count = iota
+	// 書記素クラスタ数。Blueskyなど
+	CountGraphemes
+	// UTF-8のバイト数
+	CountBytes
+)
+
+func (c Count) String() string {
+	switch c {
+	case CountGraphemes:
+		return "graphemes"
+	case CountBytes:
+		return "bytes"
+	}
+	return "runes"
+}
+
+// ParseCount は数え方の名前を変換する。空ならrunes
+func ParseCount(s string) (Count, error) {
+	switch s {
+	case "", "runes":
+		return CountRunes, nil
+	case "graphemes":
+		return CountGraphemes, nil
+	case "bytes":
+		return CountBytes, nil
+	}
+	return 0, fmt.Errorf("unknown count: %s", s)
+}
+
+// Limit は投稿先の長さの上限
+type Limit struct {
+	// 0なら上限なし
+	Max   int
+	Count Count
+}
+
+// Len はsの長さをCountで数える
+func (l Limit) Len(s string) int {
+	switch l.Count {
+	case CountGraphemes:
+		return len(graphemes(s))
+	case CountBytes:
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// Fits はsが上限に収まるかどうか
+func (l Limit) Fits(s string) bool {
+	return l.Max <= 0 || l.Len(s) <= l.Max
+}
+
+// ellipsis は切り詰めたことを示す
+const ellipsis = "…"
+
+// Truncate はsを上限に収まるよう書記素クラスタの境界で切り詰める。
+// 最後の行がURLならそれを残して本文を切り詰める
+func (l Limit) Truncate(s string) string {
+	if l.Fits(s) {
+		return s
+	}
+	body, tail := s, ""
+	if i := strings.LastIndex(s, "\n"); i >= 0 && strings.HasPrefix(s[i+1:], "https://") {
+		body, tail = s[:i], s[i:]
+	}
+	room := l.Max - l.Len(tail) - l.Len(ellipsis)
+	if room <= 0 {
+		// URLも収まらない場合は全体を切り詰める
+		body, tail = s, ""
+		room = l.Max - l.Len(ellipsis)
+	}
+	var b strings.Builder
+	n := 0
+	for _, g := range graphemes(body) {
+		w := l.Len(g)
+		if l.Count == CountGraphemes {
+			w = 1
+		}
+		if n+w > room {
+			break
+		}
+		b.WriteString(g)
+		n += w
+	}
+	return strings.TrimRight(b.String(), " \n") + ellipsis + tail
+}
+
+// graphemes はsを書記素クラスタに分ける。
+// 結合文字、異体字セレクタ、絵文字の修飾やZWJ、国旗の組み合わせを1つとして扱う簡易なもの
+func graphemes(s string) []string {
+	var gs []string
+	start := 0
+	var prev rune
+	ri := 0
+	for i, r := range s {
+		if i > 0 && !joins(prev, r, ri) {
+			gs = append(gs, s[start:i])
+			start = i
+		}
+		if isRegionalIndicator(r) {
+			ri++
+		} else {
+			ri = 0
+		}
+		prev = r
+	}
+	if start < len(s) {
+		gs = append(gs, s[start:])
+	}
+	return gs
+}
+
+// joins はprevとrが同じ書記素クラスタになるかどうか。riはprevまでに続いた国旗の文字数
+func joins(prev, r rune, ri int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case prev == '\u200d', r == '\u200d':
+		// ZWJ
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case unicode.Is(unicode.Variation_Selector, r):
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff:
+		// 肌の色
+		return true
+	case r >= 0xe0020 && r <= 0xe007f:
+		// タグ文字
+		return true
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		return ri%2 == 1
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
@@ -0,0 +1,90 @@
+package eew
+
+import "testing"
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		In   string
+		Want Count
+		Err  bool
+	}{
+		{"", CountRunes, false},
+		{"runes", CountRunes, false},
+		{"graphemes", CountGraphemes, false},
+		{"bytes", CountBytes, false},
+		{"words", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCount(tt.In)
+		if (err != nil) != tt.Err || got != tt.Want {
+			t.Errorf("%q: got:%v,%v want:%v", tt.In, got, err, tt.Want)
+		}
+	}
+}
+
+func TestLimitLen(t *testing.T) {
+	tests := []struct {
+		In        string
+		Runes     int
+		Graphemes int
+		Bytes     int
+	}{
+		{"震度6強", 4, 4, 10},
+		{"🌊**大津波警報**", 10, 10, 23},
+		// 異体字セレクタ付きの絵文字
+		{"\u26a0\ufe0f", 2, 1, 6},
+		// 肌の色
+		{"\U0001f44b\U0001f3fd", 2, 1, 8},
+		// ZWJでつないだ絵文字
+		{"\U0001f468\u200d\U0001f469\u200d\U0001f467", 5, 1, 18},
+		// 国旗は2文字ずつ
+		{"🇯🇵🇺🇸", 4, 2, 16},
+		// 結合文字
+		{"\u304b\u3099", 2, 1, 6},
+		{"a\r\nb", 4, 3, 4},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			Count Count
+			Want  int
+		}{
+			{CountRunes, tt.Runes},
+			{CountGraphemes, tt.Graphemes},
+			{CountBytes, tt.Bytes},
+		} {
+			if got := (Limit{Count: c.Count}).Len(tt.In); got != c.Want {
+				t.Errorf("%q %s: got:%d want:%d", tt.In, c.Count, got, c.Want)
+			}
+		}
+	}
+}
+
+func TestLimitTruncate(t *testing.T) {
+	url := "https://example.com/a"
+	tests := []struct {
+		Limit Limit
+		In    string
+		Want  string
+	}{
+		// 上限なし
+		{Limit{}, "震度6強", "震度6強"},
+		{Limit{Max: 4}, "震度6強", "震度6強"},
+		{Limit{Max: 3}, "震度6強", "震度…"},
+		// 書記素クラスタの途中で切らない
+		{Limit{Max: 4, Count: CountGraphemes}, "🇯🇵🇺🇸🇯🇵🇺🇸🇯🇵", "🇯🇵🇺🇸🇯🇵…"},
+		{Limit{Max: 7, Count: CountBytes}, "震度6強", "震…"},
+		// 最後の行のURLは残す
+		{Limit{Max: 27}, "震度6強\n岩手県\n" + url, "震度6強…\n" + url},
+		// URLも収まらなければ全体を切り詰める
+		{Limit{Max: 10}, "震度6強\n" + url, "震度6強\nhttp…"},
+	}
+	for _, tt := range tests {
+		got := tt.Limit.Truncate(tt.In)
+		if got != tt.Want {
+			t.Errorf("%+v %q: got:%q want:%q", tt.Limit, tt.In, got, tt.Want)
+		}
+		if !tt.Limit.Fits(got) {
+			t.Errorf("%+v %q: %q does not fit", tt.Limit, tt.In, got)
+		}
+	}
+}
@@ -93,13 +93,105 @@ func (i *Intensity) String() string {
 	return fmt.Sprintf("震度%s", to)
 }
 
-type Magnitude string
+// LgString は長周期地震動階級として"長周期地震動階級3"のようにする
+func (i *Intensity) LgString() string {
+	if i == nil {
+		return "長周期地震動階級不明"
+	}
+	if i.To == "over" {
+		return fmt.Sprintf("長周期地震動階級%s以上", i.From)
+	}
+	return fmt.Sprintf("長周期地震動階級%s", i.To)
+}
 
-func (m Magnitude) String() string {
-	if m == "" {
+// intensityClasses は震度階級を小さい順に並べたもの
+var intensityClasses = []string{"0", "1", "2", "3", "4", "5-", "5+", "6-", "6+", "7"}
+
+// IntensityRank は震度階級の順位を返す。不明な場合は-1
+func IntensityRank(class string) int {
+	for i, c := range intensityClasses {
+		if c == class {
+			return i
+		}
+	}
+	return -1
+}
+
+// lgIntensityClasses は長周期地震動階級を小さい順に並べたもの
+var lgIntensityClasses = []string{"0", "1", "2", "3", "4"}
+
+// LgIntensityRank は長周期地震動階級の順位を返す。不明な場合は-1
+func LgIntensityRank(class string) int {
+	for i, c := range lgIntensityClasses {
+		if c == class {
+			return i
+		}
+	}
+	return -1
+}
+
+// Max は予測される最大の震度階級を返す。「〜以上」の場合は下限を返す
+func (i *Intensity) Max() string {
+	if i == nil {
+		return ""
+	}
+	if i.To == "over" {
+		return i.From
+	}
+	return i.To
+}
+
+// Magnitude はjmx_eb:Magnitude
+type Magnitude struct {
+	Value float64
+	// Mj、Mなど
+	Type string
+	// "Ｍ８．４"など。JSON形式には含まれない
+	Description string
+	// "不明"、"Ｍ８を超える巨大地震"など。空でなければValueは使えない
+	Condition string
+}
+
+// Float は数値に変換する。不明な場合はfalseを返す
+func (m *Magnitude) Float() (float64, bool) {
+	if m == nil || m.Condition != "" {
+		return 0, false
+	}
+	return m.Value, true
+}
+
+func (m *Magnitude) String() string {
+	if m == nil {
 		return "不明"
 	}
-	return fmt.Sprintf("%s", string(m))
+	if m.Condition != "" {
+		if m.Condition == MagnitudeConditionUnknown {
+			return "不明"
+		}
+		return m.Condition
+	}
+	return strconv.FormatFloat(m.Value, 'f', 1, 64)
+}
+
+// jmx_eb:Magnitudeのconditionで値が不明なことを表す
+const MagnitudeConditionUnknown = "不明"
+
+func parseMagnitude(n *xmlquery.Node) (*Magnitude, error) {
+	m := Magnitude{
+		Type:        n.SelectAttr("type"),
+		Description: n.SelectAttr("description"),
+		Condition:   n.SelectAttr("condition"),
+	}
+	if s := n.InnerText(); s != "NaN" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		m.Value = v
+	} else if m.Condition == "" {
+		m.Condition = MagnitudeConditionUnknown
+	}
+	return &m, nil
 }
 
 type Serial int
@@ -117,17 +209,288 @@ func (l IsLast) String() string {
 	return ""
 }
 
+// Kind は電文中のKind要素（Name/Code）
+type Kind struct {
+	Name string
+	Code string
+}
+
+// ForecastArea は細分区域ごとの予測
+type ForecastArea struct {
+	PrefName string
+	PrefCode string
+	Name     string
+	Code     string
+	// 予測震度
+	Intensity *Intensity
+	// 予測長周期地震動階級
+	LgIntensity *Intensity
+	// 主要動の到達予測時刻。既に到達している場合などは空
+	ArrivalTime *time.Time
+	Kind        Kind
+	// 既に主要動到達と推測 など
+	Condition string
+}
+
+// WarningArea は緊急地震速報（警報）の対象区域。Head/Headline/Informationの各Area
+type WarningArea struct {
+	Name     string
+	Code     string
+	Kind     Kind
+	LastKind Kind
+}
+
+// IsNew は今回新たに警報の対象となった区域かどうか
+func (a WarningArea) IsNew() bool {
+	return a.LastKind.Code != a.Kind.Code
+}
+
+// Warning は緊急地震速報（警報）の対象となった区域の一覧
+type Warning struct {
+	// 地方予報区（東北、関東など）
+	Regions []WarningArea
+	// 府県予報区（宮城、岩手など）
+	Prefs []WarningArea
+	// 細分区域（宮城県北部など）
+	Areas []WarningArea
+}
+
+// Summary は投稿に使う区域。長くなりすぎないよう地方予報区を優先する
+func (w *Warning) Summary() []WarningArea {
+	if w == nil {
+		return nil
+	}
+	if len(w.Regions) > 0 {
+		return w.Regions
+	}
+	return w.Prefs
+}
+
+// Added はSummaryのうち前の報から新たに加わった区域。
+// すべて新しい場合は対象区域そのものと同じになるのでnilを返す
+func (w *Warning) Added() []WarningArea {
+	areas := w.Summary()
+	n := NewAreas(areas)
+	if len(n) == len(areas) {
+		return nil
+	}
+	return n
+}
+
+// NewAreas はareasのうち新たに警報の対象となったもの
+func NewAreas(areas []WarningArea) []WarningArea {
+	var n []WarningArea
+	for _, a := range areas {
+		if a.IsNew() {
+			n = append(n, a)
+		}
+	}
+	return n
+}
+
+func names(areas []WarningArea) string {
+	s := make([]string, 0, len(areas))
+	for _, a := range areas {
+		s = append(s, a.Name)
+	}
+	return strings.Join(s, "、")
+}
+
+// ObservedArea は細分区域ごとの観測された震度
+type ObservedArea struct {
+	Name   string
+	Code   string
+	MaxInt string
+}
+
+// ObservedPref は都道府県ごとの観測された震度
+type ObservedPref struct {
+	Name   string
+	Code   string
+	MaxInt string
+	Areas  []ObservedArea
+}
+
+// Observation は地震情報で観測された震度
+type Observation struct {
+	// 最大震度。"5-"など
+	MaxInt string
+	Prefs  []ObservedPref
+}
+
+// AreaIntensity は細分区域ごとの震度
+type AreaIntensity struct {
+	Name string
+	Code string
+	// "5-"など
+	Intensity string
+}
+
+// AreaIntensities は細分区域ごとの震度。緊急地震速報では予測震度、地震情報では観測された震度
+func (c Content) AreaIntensities() []AreaIntensity {
+	var areas []AreaIntensity
+	for _, a := range c.Areas {
+		if i := a.Intensity.Max(); i != "" {
+			areas = append(areas, AreaIntensity{Name: a.Name, Code: a.Code, Intensity: i})
+		}
+	}
+	if c.Observation != nil {
+		for _, p := range c.Observation.Prefs {
+			for _, a := range p.Areas {
+				areas = append(areas, AreaIntensity{Name: a.Name, Code: a.Code, Intensity: a.MaxInt})
+			}
+		}
+	}
+	return areas
+}
+
+// IntensityGroup は同じ震度の細分区域をまとめたもの
+type IntensityGroup struct {
+	Intensity string
+	Areas     []string
+}
+
+// IntensityGroups はAreaIntensitiesを震度の大きい順にまとめる。震度0や不明は含めない
+func (c Content) IntensityGroups() []IntensityGroup {
+	areas := c.AreaIntensities()
+	var groups []IntensityGroup
+	for i := len(intensityClasses) - 1; i > 0; i-- {
+		g := IntensityGroup{Intensity: intensityClasses[i]}
+		for _, a := range areas {
+			if a.Intensity == g.Intensity {
+				g.Areas = append(g.Areas, a.Name)
+			}
+		}
+		if len(g.Areas) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// Control/Title
+const (
+	// 緊急地震速報（警報）VXSE43
+	TitleWarning = "緊急地震速報（警報）"
+	// 震度速報 VXSE51
+	TitleIntensity = "震度速報"
+	// 震源に関する情報 VXSE52
+	TitleHypocenter = "震源に関する情報"
+	// 震源・震度に関する情報 VXSE53
+	TitleEarthquake = "震源・震度に関する情報"
+	// 津波警報・注意報・予報 VTSE41
+	TitleTsunamiWarning = "津波警報・注意報・予報a"
+	// 津波情報 VTSE51
+	TitleTsunamiInfo = "津波情報a"
+)
+
+const (
+	StatusNormal   = "通常"
+	StatusTraining = "訓練"
+	StatusTest     = "試験"
+)
+
+const (
+	InfoTypeIssue      = "発表"
+	InfoTypeCorrection = "訂正"
+	InfoTypeCancel     = "取消"
+)
+
 type Content struct {
-	EventId   string
+	EventId string
+	// Control/Title
+	Title string
+	// Head/ReportDateTime
+	ReportDateTime time.Time
+	// Control/Status
+	Status    string
+	InfoType  string
 	Time      *ReportTime
 	AreaName  string
 	LatLng    *LatLng
 	Depth     *Depth
-	Magnitude Magnitude
+	Magnitude *Magnitude
 	Intensity *Intensity
-	Serial    Serial
-	IsLast    IsLast
-	Url       string
+	// 予測される最大の長周期地震動階級。発表されていなければnil
+	LgIntensity *Intensity
+	Serial      Serial
+	IsLast      IsLast
+	Url         string
+	Areas       []ForecastArea
+	// Body/Text。取消報などで使われる
+	Text string
+	// Head/Headline/Text。"三陸沖で地震　東北　関東で強い揺れ"など
+	Headline string
+	// Head/Headline/Informationの強い揺れが予想される区域。予報にも含まれる。
+	// 警報が発表されていなければnil
+	Warning *Warning
+	// 地震情報で観測された震度。震度速報、震源・震度に関する情報のみ
+	Observation *Observation
+	// Body/Comments/ForecastComment。津波の有無など
+	Comment string
+	// 津波警報・注意報・予報、津波情報の内容
+	Tsunami *Tsunami
+	// Body/Earthquake/Condition。仮定震源要素の場合のみ
+	HypocenterCondition string
+	// 震源とマグニチュードの精度。緊急地震速報のみ
+	Accuracy *Accuracy
+	// 震央地名コード
+	AreaCode string
+	// 短縮用震央地名。文字数の限られた投稿先で使う。緊急地震速報のみ
+	ReduceName string
+	ReduceCode string
+	// 海域、内陸。緊急地震速報のみ
+	LandOrSea string
+	// DMDATA.JPの試験電文フラグ
+	Test bool
+}
+
+// IsTraining は訓練・試験の電文かどうか
+func (c Content) IsTraining() bool {
+	return c.Test || (c.Status != "" && c.Status != StatusNormal)
+}
+
+// IsWarning は緊急地震速報（警報）かどうか
+func (c Content) IsWarning() bool {
+	return c.Title == TitleWarning
+}
+
+// IsEarthquakeInfo は緊急地震速報の後に発表される地震情報（VXSE51/52/53）かどうか
+func (c Content) IsEarthquakeInfo() bool {
+	switch c.Title {
+	case TitleIntensity, TitleHypocenter, TitleEarthquake:
+		return true
+	}
+	return false
+}
+
+// IsTsunami は津波警報・注意報・予報（VTSE41）または津波情報（VTSE51）かどうか
+func (c Content) IsTsunami() bool {
+	return c.Title == TitleTsunamiWarning || c.Title == TitleTsunamiInfo
+}
+
+// LandOrSea
+const (
+	LandOrSeaSea  = "海域"
+	LandOrSeaLand = "内陸"
+)
+
+// IsOffshore は震源が海域かどうか。LandOrSeaがなければfalse
+func (c Content) IsOffshore() bool {
+	return c.LandOrSea == LandOrSeaSea
+}
+
+// ShortAreaName は短縮用震央地名。なければ震央地名を返す
+func (c Content) ShortAreaName() string {
+	if c.ReduceName != "" {
+		return c.ReduceName
+	}
+	return c.AreaName
+}
+
+// IsCanceled は取消報かどうか
+func (c Content) IsCanceled() bool {
+	return c.InfoType == InfoTypeCancel
 }
 
 func NewContent(r io.Reader) (*Content, error) {
@@ -141,9 +504,32 @@ func NewContent(r io.Reader) (*Content, error) {
 
 	root := xmlquery.FindOne(doc, "//Report")
 
+	if n := root.SelectElement("//Control/Title"); n != nil {
+		content.Title = n.InnerText()
+	}
+	if n := root.SelectElement("//Control/Status"); n != nil {
+		content.Status = n.InnerText()
+	}
 	if n := root.SelectElement("//Head/EventID"); n != nil {
 		content.EventId = n.InnerText()
 	}
+	if n := root.SelectElement("//Head/InfoType"); n != nil {
+		content.InfoType = n.InnerText()
+	}
+	if n := root.SelectElement("//Head/ReportDateTime"); n != nil {
+		t, err := time.Parse(time.RFC3339, n.InnerText())
+		if err != nil {
+			slog.Error("Failed to parse ReportDateTime", err)
+			return nil, err
+		}
+		content.ReportDateTime = t
+	}
+	if n := root.SelectElement("//Head/Headline/Text"); n != nil {
+		content.Headline = n.InnerText()
+	}
+	if n := root.SelectElement("//Body/Text"); n != nil {
+		content.Text = n.InnerText()
+	}
 
 	if n := root.SelectElement("//Body/Earthquake/OriginTime"); n != nil {
 		t, err := time.Parse("2006-01-02T15:04:05-07:00", n.InnerText())
@@ -161,6 +547,15 @@ func NewContent(r io.Reader) (*Content, error) {
 		}
 		rt := ReportTime(t)
 		content.Time = &rt
+	} else if n := root.SelectElement("//Head/TargetDateTime"); n != nil && content.IsEarthquakeInfo() {
+		// 震度速報には震源要素がないので地震の発生した時刻を使う
+		t, err := time.Parse("2006-01-02T15:04:05-07:00", n.InnerText())
+		if err != nil {
+			slog.Error("Failed to parse TargetDateTime", err)
+			return nil, err
+		}
+		rt := ReportTime(t)
+		content.Time = &rt
 	}
 	if n := root.SelectElement("//Body/Earthquake/Hypocenter/Area/Name"); n != nil {
 		content.AreaName = n.InnerText()
@@ -173,18 +568,55 @@ func NewContent(r io.Reader) (*Content, error) {
 			slog.Error("Failed to parse coordinate", err)
 		}
 	}
+	if n := root.SelectElement("//Body/Earthquake/Condition"); n != nil {
+		content.HypocenterCondition = n.InnerText()
+	}
+	content.Accuracy = parseAccuracy(root)
+	if n := root.SelectElement("//Body/Earthquake/Hypocenter/Area/Code"); n != nil {
+		content.AreaCode = n.InnerText()
+	}
+	if n := root.SelectElement("//Body/Earthquake/Hypocenter/Area/ReduceName"); n != nil {
+		content.ReduceName = n.InnerText()
+	}
+	if n := root.SelectElement("//Body/Earthquake/Hypocenter/Area/ReduceCode"); n != nil {
+		content.ReduceCode = n.InnerText()
+	}
+	if n := root.SelectElement("//Body/Earthquake/Hypocenter/Area/LandOrSea"); n != nil {
+		content.LandOrSea = n.InnerText()
+	}
 	if n := root.SelectElement("//Body/Earthquake/jmx_eb:Magnitude"); n != nil {
-		content.Magnitude = Magnitude(n.InnerText())
+		m, err := parseMagnitude(n)
+		if err != nil {
+			slog.Error("Failed to parse magnitude", err, slog.Any("magnitude", n.InnerText()))
+			return nil, err
+		}
+		content.Magnitude = m
 	}
 	if n := root.SelectElement("//Body/Intensity/Forecast/ForecastInt"); n != nil {
-		from := n.SelectElement("/From")
-		to := n.SelectElement("/To")
-		content.Intensity = &Intensity{
-			From: from.InnerText(),
-			To:   to.InnerText(),
-		}
+		content.Intensity = parseIntensity(n)
+	}
+	if n := root.SelectElement("//Body/Intensity/Forecast/ForecastLgInt"); n != nil {
+		content.LgIntensity = parseIntensity(n)
+	}
+	areas, err := parseForecastAreas(root)
+	if err != nil {
+		slog.Error("Failed to parse forecast areas", err)
+		return nil, err
 	}
-	if n := root.SelectElement("//Head/Serial"); n != nil {
+	content.Areas = areas
+	content.Warning = parseWarning(root)
+	content.Observation = parseObservation(root)
+	if n := root.SelectElement("//Body/Comments/ForecastComment/Text"); n != nil {
+		content.Comment = n.InnerText()
+	}
+	tsunami, err := parseTsunami(root)
+	if err != nil {
+		slog.Error("Failed to parse tsunami", err)
+		return nil, err
+	}
+	content.Tsunami = tsunami
+	// 津波の電文にはSerialがない
+	if n := root.SelectElement("//Head/Serial"); n != nil && n.InnerText() != "" {
 		serial, err := strconv.Atoi(n.InnerText())
 		if err != nil {
 			slog.Error("Failed to Atoi serial", err, slog.Any("serial", n.InnerText()))
@@ -198,13 +630,175 @@ func NewContent(r io.Reader) (*Content, error) {
 		}
 	}
 
-	if t, err := time.Parse("20060102150405", content.EventId); err == nil {
-		content.Url = fmt.Sprintf("https://earthquake.tenki.jp/bousai/earthquake/detail/%s.html", t.Format("2006/01/02/2006-01-02-15-04-05"))
-	}
+	content.Url = detailUrl(content.EventId)
 
 	return &content, nil
 }
 
+// detailUrl はtenki.jpの地震情報のURL
+func detailUrl(eventId string) string {
+	t, err := time.Parse("20060102150405", eventId)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("https://earthquake.tenki.jp/bousai/earthquake/detail/%s.html", t.Format("2006/01/02/2006-01-02-15-04-05"))
+}
+
+func parseIntensity(n *xmlquery.Node) *Intensity {
+	var i Intensity
+	if from := n.SelectElement("From"); from != nil {
+		i.From = from.InnerText()
+	}
+	if to := n.SelectElement("To"); to != nil {
+		i.To = to.InnerText()
+	}
+	return &i
+}
+
+func parseForecastAreas(root *xmlquery.Node) ([]ForecastArea, error) {
+	var areas []ForecastArea
+	for _, pref := range xmlquery.Find(root, "//Body/Intensity/Forecast/Pref") {
+		var prefName, prefCode string
+		if n := pref.SelectElement("Name"); n != nil {
+			prefName = n.InnerText()
+		}
+		if n := pref.SelectElement("Code"); n != nil {
+			prefCode = n.InnerText()
+		}
+		for _, n := range pref.SelectElements("Area") {
+			area := ForecastArea{
+				PrefName: prefName,
+				PrefCode: prefCode,
+			}
+			if v := n.SelectElement("Name"); v != nil {
+				area.Name = v.InnerText()
+			}
+			if v := n.SelectElement("Code"); v != nil {
+				area.Code = v.InnerText()
+			}
+			if v := n.SelectElement("Category/Kind"); v != nil {
+				area.Kind = parseKind(v)
+			}
+			if v := n.SelectElement("ForecastInt"); v != nil {
+				area.Intensity = parseIntensity(v)
+			}
+			if v := n.SelectElement("ForecastLgInt"); v != nil {
+				area.LgIntensity = parseIntensity(v)
+			}
+			if v := n.SelectElement("ArrivalTime"); v != nil {
+				t, err := time.Parse(time.RFC3339, v.InnerText())
+				if err != nil {
+					return nil, err
+				}
+				area.ArrivalTime = &t
+			}
+			if v := n.SelectElement("Condition"); v != nil {
+				area.Condition = v.InnerText()
+			}
+			areas = append(areas, area)
+		}
+	}
+	return areas, nil
+}
+
+// Head/Headline/Informationのtype
+const (
+	informationRegion = "緊急地震速報（地方予報区）"
+	informationPref   = "緊急地震速報（府県予報区）"
+	informationArea   = "緊急地震速報（細分区域）"
+)
+
+func parseWarning(root *xmlquery.Node) *Warning {
+	var w Warning
+	found := false
+	for _, info := range xmlquery.Find(root, "//Head/Headline/Information") {
+		var areas *[]WarningArea
+		switch info.SelectAttr("type") {
+		case informationRegion:
+			areas = &w.Regions
+		case informationPref:
+			areas = &w.Prefs
+		case informationArea:
+			areas = &w.Areas
+		default:
+			continue
+		}
+		for _, item := range info.SelectElements("Item") {
+			var kind, lastKind Kind
+			if v := item.SelectElement("Kind"); v != nil {
+				kind = parseKind(v)
+			}
+			if v := item.SelectElement("LastKind"); v != nil {
+				lastKind = parseKind(v)
+			}
+			for _, n := range xmlquery.Find(item, "Areas/Area") {
+				a := WarningArea{Kind: kind, LastKind: lastKind}
+				if v := n.SelectElement("Name"); v != nil {
+					a.Name = v.InnerText()
+				}
+				if v := n.SelectElement("Code"); v != nil {
+					a.Code = v.InnerText()
+				}
+				*areas = append(*areas, a)
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &w
+}
+
+func parseObservation(root *xmlquery.Node) *Observation {
+	n := root.SelectElement("//Body/Intensity/Observation")
+	if n == nil {
+		return nil
+	}
+	var o Observation
+	if v := n.SelectElement("MaxInt"); v != nil {
+		o.MaxInt = v.InnerText()
+	}
+	for _, pref := range n.SelectElements("Pref") {
+		var p ObservedPref
+		if v := pref.SelectElement("Name"); v != nil {
+			p.Name = v.InnerText()
+		}
+		if v := pref.SelectElement("Code"); v != nil {
+			p.Code = v.InnerText()
+		}
+		if v := pref.SelectElement("MaxInt"); v != nil {
+			p.MaxInt = v.InnerText()
+		}
+		for _, area := range pref.SelectElements("Area") {
+			var a ObservedArea
+			if v := area.SelectElement("Name"); v != nil {
+				a.Name = v.InnerText()
+			}
+			if v := area.SelectElement("Code"); v != nil {
+				a.Code = v.InnerText()
+			}
+			if v := area.SelectElement("MaxInt"); v != nil {
+				a.MaxInt = v.InnerText()
+			}
+			p.Areas = append(p.Areas, a)
+		}
+		o.Prefs = append(o.Prefs, p)
+	}
+	return &o
+}
+
+func parseKind(n *xmlquery.Node) Kind {
+	var k Kind
+	if v := n.SelectElement("Name"); v != nil {
+		k.Name = v.InnerText()
+	}
+	if v := n.SelectElement("Code"); v != nil {
+		k.Code = v.InnerText()
+	}
+	return k
+}
+
 func (c *Content) ParseCoordinate(coordinate string) error {
 	var coordinates []string
 	var s strings.Builder
@@ -247,6 +841,20 @@ func (c *Content) ParseCoordinate(coordinate string) error {
 	return nil
 }
 
+// String は既定のテンプレートで作った投稿文
 func (c Content) String() string {
-	return fmt.Sprintf("**緊急地震速報（予報）** %s%s\n%sごろ、地震がありました。\n震源地は%s（%s）で震源の深さは%s、地震の規模（マグニチュード）は%s、この地震による最大震度は%sと推定されます。\n%s", c.Serial, c.IsLast, c.Time, c.AreaName, c.LatLng, c.Depth, c.Magnitude, c.Intensity, c.Url)
+	s, err := DefaultRenderer.Render(&c, false)
+	if err != nil {
+		slog.Error("Failed to render content", err, slog.Any("eventId", c.EventId), slog.Any("title", c.Title))
+		return ""
+	}
+	return s
+}
+
+// intensityName は震度階級を"震度6強"のようにする
+func intensityName(class string) string {
+	if class == "" {
+		return "震度不明"
+	}
+	return (&Intensity{From: class, To: class}).String()
 }
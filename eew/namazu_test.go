@@ -2,7 +2,11 @@ package eew
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/antchfx/xmlquery"
 )
 
 func TestParseXml(t *testing.T) {
@@ -13,11 +17,35 @@ func TestParseXml(t *testing.T) {
 	tests := []data{
 		{
 			File:    "samples/77_01_01_110311_VXSE45.xml",
-			Message: "**緊急地震速報（予報）** 第23報\n11日14時46分ごろ、地震がありました。\n震源地は三陸沖（北緯38.1度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は8.4、この地震による最大震度は震度6強と推定されます。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+			Message: "**緊急地震速報（予報）** 第23報\n11日14時46分ごろ、地震がありました。\n震源地は三陸沖（北緯38.1度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は8.4、この地震による最大震度は震度6強、長周期地震動階級4と推定されます。\n新たに東海、伊豆諸島、近畿でも強い揺れが予想されます。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_01_110311_VXSE43.xml",
+			Message: "🚨**緊急地震速報（警報）** 第23報\n強い揺れに警戒してください。\n対象地域：東北、関東、北陸、甲信、北海道、東海、伊豆諸島、近畿\n新たに警報：東海、伊豆諸島、近畿\n11日14時46分ごろ、地震がありました。\n震源地は三陸沖（北緯38.1度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は8.4と推定されます。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_03_110311_VXSE51.xml",
+			Message: "**震度速報**\n11日14時46分ごろ、地震による強い揺れを感じました。\n観測された最大震度は震度7です。\n宮城県：震度7\n福島県：震度6強\n茨城県：震度6強\n栃木県：震度6強\n岩手県：震度6弱\n今後の情報に注意してください。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_04_110311_VXSE52.xml",
+			Message: "**震源に関する情報**\n11日14時46分ごろ、地震がありました。\n震源地は三陸沖（北緯38度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は7.9と推定されます。\n津波警報等（大津波警報・津波警報あるいは津波注意報）を発表中です。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_05_110311_VXSE53.xml",
+			Message: "**震源・震度に関する情報**\n11日14時46分ごろ、地震がありました。\n震源地は三陸沖（北緯38度、東経142.9度）で震源の深さは約10km、地震の規模（マグニチュード）は7.9と推定されます。\n観測された最大震度は震度7です。\n宮城県：震度7\n福島県：震度6強\n茨城県：震度6強\n栃木県：震度6強\n岩手県：震度6弱\n津波警報等（大津波警報・津波警報あるいは津波注意報）を発表中です。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_06_110311_VTSE41.xml",
+			Message: "🌊**大津波警報**\n11日14時46分ごろ発生した三陸沖の地震（M7.9）による津波\n【大津波警報】\n岩手県 ３ｍ 15時00分到達予想\n宮城県 ６ｍ 15時00分到達予想\n福島県 ３ｍ 15時10分到達予想\n【津波警報】\n北海道太平洋沿岸中部 ２ｍ 15時30分到達予想\n青森県太平洋沿岸 １ｍ 15時30分到達予想\n茨城県 ２ｍ 15時30分到達予想\n千葉県九十九里・外房 ２ｍ 15時40分到達予想\n【津波注意報】北海道太平洋沿岸東部、青森県日本海沿岸、千葉県内房、伊豆諸島\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+		},
+		{
+			File:    "samples/77_01_07_110311_VTSE51.xml",
+			Message: "🌊**大津波警報**\n11日14時46分ごろ発生した三陸沖の地震（M7.9）による津波\n【大津波警報】\n岩手県 ３ｍ 15時00分到達予想\n宮城県 ６ｍ 15時00分到達予想\n福島県 ３ｍ 15時10分到達予想\n【津波警報】\n北海道太平洋沿岸中部 ２ｍ 15時30分到達予想\n青森県太平洋沿岸 １ｍ 15時30分到達予想\n茨城県 ２ｍ 15時30分到達予想\n千葉県九十九里・外房 ２ｍ 15時40分到達予想\n【津波注意報】北海道太平洋沿岸東部、青森県日本海沿岸、千葉県内房、伊豆諸島\n【観測】宮古 ８．５ｍ以上（15時26分）\n【観測】釜石 ４．２ｍ以上（15時21分）\n【観測】石巻市鮎川 ３．３ｍ以上（15時26分）\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
 		},
 		{
 			File:    "samples/77_01_02_110311_VXSE45.xml",
-			Message: "**緊急地震速報（予報）** 第23報\n不明ごろ、地震がありました。\n震源地は不明（経緯不明）で震源の深さは不明、地震の規模（マグニチュード）は不明、この地震による最大震度は不明と推定されます。\nhttps://earthquake.tenki.jp/bousai/earthquake/detail/2011/03/11/2011-03-11-14-46-40.html",
+			Message: "**緊急地震速報（予報）** 第23報 *取消*\n先ほどの、緊急地震速報（地震動予報）を取り消します。",
 		},
 	}
 	for _, d := range tests {
@@ -37,3 +65,266 @@ func TestParseXml(t *testing.T) {
 		}
 	}
 }
+
+func TestParseForecastAreas(t *testing.T) {
+	f, err := os.Open("samples/77_01_01_110311_VXSE45.xml")
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	defer f.Close()
+	content, err := NewContent(f)
+	if err != nil {
+		t.Fatalf("failed to parseXml: %v", err)
+	}
+	if got, want := len(content.Areas), 58; got != want {
+		t.Fatalf("len(Areas) got:%d want:%d", got, want)
+	}
+
+	first := content.Areas[0]
+	if first.PrefName != "宮城" || first.PrefCode != "9040" || first.Name != "宮城県北部" || first.Code != "220" {
+		t.Errorf("unexpected area: %+v", first)
+	}
+	if got, want := first.Intensity.String(), "震度6強"; got != want {
+		t.Errorf("Intensity got:%s want:%s", got, want)
+	}
+	if got, want := *first.LgIntensity, (Intensity{From: "4", To: "4"}); got != want {
+		t.Errorf("LgIntensity got:%v want:%v", got, want)
+	}
+	if got, want := first.Kind, (Kind{Name: "緊急地震速報（警報）", Code: "11"}); got != want {
+		t.Errorf("Kind got:%v want:%v", got, want)
+	}
+	if got, want := first.Condition, "既に主要動到達と推測"; got != want {
+		t.Errorf("Condition got:%s want:%s", got, want)
+	}
+	if first.ArrivalTime != nil {
+		t.Errorf("ArrivalTime got:%v want:nil", first.ArrivalTime)
+	}
+
+	last := content.Areas[len(content.Areas)-1]
+	if last.Name != "大阪府南部" || last.ArrivalTime == nil {
+		t.Fatalf("unexpected area: %+v", last)
+	}
+	if got, want := last.ArrivalTime.Format(time.RFC3339), "2011-03-11T14:50:35+09:00"; got != want {
+		t.Errorf("ArrivalTime got:%s want:%s", got, want)
+	}
+}
+
+func TestIsCanceled(t *testing.T) {
+	tests := map[string]bool{
+		"samples/77_01_01_110311_VXSE45.xml": false,
+		"samples/77_01_02_110311_VXSE45.xml": true,
+	}
+	for file, want := range tests {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", file)
+		}
+		content, err := NewContent(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to parseXml: %v", err)
+		}
+		if got := content.IsCanceled(); got != want {
+			t.Errorf("%s: IsCanceled got:%v want:%v", file, got, want)
+		}
+	}
+}
+
+func TestParseWarning(t *testing.T) {
+	tests := []struct {
+		File    string
+		Warning bool
+	}{
+		{"samples/77_01_01_110311_VXSE43.xml", true},
+		{"samples/77_01_01_110311_VXSE45.xml", false},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(tt.File)
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", tt.File)
+		}
+		content, err := NewContent(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to parseXml: %v", err)
+		}
+		if got := content.IsWarning(); got != tt.Warning {
+			t.Errorf("%s: IsWarning got:%v want:%v", tt.File, got, tt.Warning)
+		}
+		// 予報にも警報の対象区域が含まれる
+		w := content.Warning
+		if w == nil {
+			t.Fatalf("%s: no warning areas", tt.File)
+		}
+		if got, want := len(w.Regions), 8; got != want {
+			t.Errorf("%s: len(Regions) got:%d want:%d", tt.File, got, want)
+		}
+		if got, want := len(w.Prefs), 22; got != want {
+			t.Errorf("%s: len(Prefs) got:%d want:%d", tt.File, got, want)
+		}
+		if got, want := len(NewAreas(w.Prefs)), 5; got != want {
+			t.Errorf("%s: len(NewAreas(Prefs)) got:%d want:%d", tt.File, got, want)
+		}
+		if a := w.Prefs[0]; a.Name != "宮城" || a.Code != "9040" || a.IsNew() {
+			t.Errorf("%s: unexpected pref: %+v", tt.File, a)
+		}
+		if got, want := names(w.Added()), "東海、伊豆諸島、近畿"; got != want {
+			t.Errorf("%s: Added got:%s want:%s", tt.File, got, want)
+		}
+		if got, want := content.Headline, "三陸沖で地震　東北　関東　北陸　甲信　東海　北海道　伊豆諸島　近畿で強い揺れ"; got != want {
+			t.Errorf("%s: Headline got:%s want:%s", tt.File, got, want)
+		}
+	}
+
+	f, err := os.Open("samples/77_01_02_110311_VXSE45.xml")
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	defer f.Close()
+	content, err := NewContent(f)
+	if err != nil {
+		t.Fatalf("failed to parseXml: %v", err)
+	}
+	if content.Warning != nil {
+		t.Errorf("Warning got:%+v want:nil", content.Warning)
+	}
+}
+
+func TestParseObservation(t *testing.T) {
+	tests := []struct {
+		File  string
+		Prefs int
+		Areas int
+	}{
+		{"samples/77_01_03_110311_VXSE51.xml", 5, 11},
+		{"samples/77_01_04_110311_VXSE52.xml", 0, 0},
+		{"samples/77_01_05_110311_VXSE53.xml", 5, 11},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(tt.File)
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", tt.File)
+		}
+		content, err := NewContent(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to parseXml: %v", err)
+		}
+		if !content.IsEarthquakeInfo() {
+			t.Errorf("%s: IsEarthquakeInfo got:false want:true", tt.File)
+		}
+		o := content.Observation
+		if tt.Prefs == 0 {
+			if o != nil {
+				t.Errorf("%s: Observation got:%+v want:nil", tt.File, o)
+			}
+			continue
+		}
+		if o == nil || o.MaxInt != "7" || len(o.Prefs) != tt.Prefs {
+			t.Fatalf("%s: unexpected observation: %+v", tt.File, o)
+		}
+		areas := 0
+		for _, p := range o.Prefs {
+			areas += len(p.Areas)
+		}
+		if areas != tt.Areas {
+			t.Errorf("%s: areas got:%d want:%d", tt.File, areas, tt.Areas)
+		}
+		if a := o.Prefs[0].Areas[0]; a.Name != "宮城県北部" || a.Code != "220" || a.MaxInt != "7" {
+			t.Errorf("%s: unexpected area: %+v", tt.File, a)
+		}
+	}
+}
+
+func TestParseMagnitude(t *testing.T) {
+	tests := []struct {
+		Xml    string
+		Float  float64
+		Ok     bool
+		String string
+	}{
+		{`<jmx_eb:Magnitude type="Mj" description="Ｍ８．４">8.4</jmx_eb:Magnitude>`, 8.4, true, "8.4"},
+		{`<jmx_eb:Magnitude type="Mj" description="Ｍ１．０">1.0</jmx_eb:Magnitude>`, 1.0, true, "1.0"},
+		{`<jmx_eb:Magnitude type="Mj" condition="不明" description="Ｍ不明">NaN</jmx_eb:Magnitude>`, 0, false, "不明"},
+		{`<jmx_eb:Magnitude type="Mj" condition="Ｍ８を超える巨大地震" description="Ｍ８を超える巨大地震">NaN</jmx_eb:Magnitude>`, 0, false, "Ｍ８を超える巨大地震"},
+		// conditionがなくてもNaNは不明とする
+		{`<jmx_eb:Magnitude type="Mj">NaN</jmx_eb:Magnitude>`, 0, false, "不明"},
+	}
+	for _, tt := range tests {
+		doc, err := xmlquery.Parse(strings.NewReader(`<Earthquake xmlns:jmx_eb="http://xml.kishou.go.jp/jmaxml1/elementBasis1/">` + tt.Xml + `</Earthquake>`))
+		if err != nil {
+			t.Fatalf("failed to parse xml: %v", err)
+		}
+		m, err := parseMagnitude(xmlquery.FindOne(doc, "//jmx_eb:Magnitude"))
+		if err != nil {
+			t.Fatalf("failed to parse magnitude: %v", err)
+		}
+		if m.Type != "Mj" {
+			t.Errorf("%s: Type got:%s want:Mj", tt.Xml, m.Type)
+		}
+		if f, ok := m.Float(); f != tt.Float || ok != tt.Ok {
+			t.Errorf("%s: Float got:%v,%v want:%v,%v", tt.Xml, f, ok, tt.Float, tt.Ok)
+		}
+		if got := m.String(); got != tt.String {
+			t.Errorf("%s: String got:%s want:%s", tt.Xml, got, tt.String)
+		}
+	}
+	var m *Magnitude
+	if _, ok := m.Float(); ok || m.String() != "不明" {
+		t.Errorf("nil magnitude must be unknown")
+	}
+}
+
+func TestParseHypocenter(t *testing.T) {
+	tests := []struct {
+		File       string
+		AreaCode   string
+		ShortName  string
+		ReduceCode string
+		Offshore   bool
+	}{
+		{"samples/77_01_01_110311_VXSE45.xml", "288", "三陸沖", "9738", true},
+		// 地震情報には短縮用震央地名がない
+		{"samples/77_01_05_110311_VXSE53.xml", "288", "三陸沖", "", false},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(tt.File)
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", tt.File)
+		}
+		content, err := NewContent(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to parseXml: %v", err)
+		}
+		if content.AreaCode != tt.AreaCode || content.ShortAreaName() != tt.ShortName || content.ReduceCode != tt.ReduceCode || content.IsOffshore() != tt.Offshore {
+			t.Errorf("%s: unexpected hypocenter: %+v", tt.File, content)
+		}
+		if m := content.Magnitude; m == nil || m.Type != "Mj" || m.Description == "" {
+			t.Errorf("%s: unexpected magnitude: %+v", tt.File, m)
+		}
+	}
+}
+
+func TestWarningAdded(t *testing.T) {
+	warned := Kind{Name: "緊急地震速報（警報）", Code: "31"}
+	none := Kind{Name: "なし", Code: "00"}
+	tests := []struct {
+		Name    string
+		Warning *Warning
+		Want    string
+	}{
+		{"nil", nil, ""},
+		// 初めて発表された場合はすべて新しいので書かない
+		{"first", &Warning{Regions: []WarningArea{{Name: "東北", Kind: warned, LastKind: none}}}, ""},
+		{"added", &Warning{Regions: []WarningArea{{Name: "東北", Kind: warned, LastKind: warned}, {Name: "北陸", Kind: warned, LastKind: none}}}, "北陸"},
+		// 地方予報区がなければ府県予報区で比べる
+		{"prefs", &Warning{Prefs: []WarningArea{{Name: "宮城", Kind: warned, LastKind: warned}, {Name: "新潟", Kind: warned, LastKind: none}}}, "新潟"},
+		{"unchanged", &Warning{Regions: []WarningArea{{Name: "東北", Kind: warned, LastKind: warned}}}, ""},
+	}
+	for _, tt := range tests {
+		if got := names(tt.Warning.Added()); got != tt.Want {
+			t.Errorf("%s: got:%s want:%s", tt.Name, got, tt.Want)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package eew
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// テンプレートの名前。電文の種類ごとに使い分ける
+const (
+	// 緊急地震速報（予報）の初報
+	TemplateFirst = "first"
+	// 緊急地震速報（予報）の続報
+	TemplateUpdate = "update"
+	// 緊急地震速報（予報）の最終報
+	TemplateFinal = "final"
+	// 取消報
+	TemplateCancel = "cancel"
+	// 緊急地震速報（警報）
+	TemplateWarning = "warning"
+	// 震度速報、震源に関する情報、震源・震度に関する情報
+	TemplateEarthquake = "earthquake"
+	// 津波警報・注意報・予報、津波情報
+	TemplateTsunami = "tsunami"
+	// 訓練・試験電文の本文を包む
+	TemplateTraining = "training"
+	// 地図画像の代替テキスト
+	TemplateAlt = "alt"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// templateFiles は言語ごとの既定のテンプレート
+var templateFiles = map[Language]string{
+	LanguageJapanese: "templates/default.tmpl",
+	LanguageEnglish:  "templates/en.tmpl",
+	LanguageChinese:  "templates/zh.tmpl",
+	LanguageKorean:   "templates/ko.tmpl",
+}
+
+// baseTemplates は言語ごとに既定のテンプレートを読み込んだもの
+var baseTemplates = mustTemplates()
+
+// DefaultRenderer は既定のテンプレートで日本語の投稿文を作る
+var DefaultRenderer = &Renderer{sets: []localized{{LanguageJapanese, baseTemplates[LanguageJapanese]}}}
+
+// 投稿先の上限に収まらない場合に省く段階。小さいものから順に省く
+const (
+	// 新たに加わった地域、精度の注意、長周期地震動階級、付加文などの補足
+	ShortenSupplement = 1
+	// 震央地名を短縮用震央地名にし、緯度経度を省く
+	ShortenHypocenter = 2
+	// 都道府県ごとの震度、予報区ごとの津波の高さや観測値などの一覧
+	ShortenList = 3
+)
+
+// Data はテンプレートに渡す値。Contentのフィールドとメソッドをそのまま使える
+type Data struct {
+	*Content
+	Language Language
+	// trainingテンプレートでのみ使う本文
+	Message string
+	// 省く段階。0なら省かない
+	Shorten int
+}
+
+// Drop はlevelの段階のものを省くかどうか
+func (d Data) Drop(level int) bool {
+	return d.Shorten >= level
+}
+
+// Renderer はtext/templateで電文から投稿文を作る。
+// 複数の言語を持つ場合は言語ごとの投稿文を並べて1つにする
+type Renderer struct {
+	sets  []localized
+	limit Limit
+}
+
+type localized struct {
+	lang Language
+	t    *template.Template
+}
+
+// funcs はテンプレートから使える関数。言語ごとに訳す
+func funcs(l Language) template.FuncMap {
+	return template.FuncMap{
+		// "6+"や*Intensityを"震度6強"にする
+		"intensity":     l.Intensity,
+		"intensityRank": IntensityRank,
+		// "3"や*Intensityを"長周期地震動階級3"にする
+		"lgIntensity":     l.LgIntensity,
+		"coordinate":      l.LatLng,
+		"depth":           l.Depth,
+		"magnitude":       l.Magnitude,
+		"localTime":       l.Time,
+		"formatTime":      formatTime,
+		"area":            l.AreaName,
+		"names":           l.Names,
+		"title":           l.Phrase,
+		"comment":         l.Comment,
+		"tsunamiCategory": l.TsunamiCategory,
+		"tsunamiHeight":   l.TsunamiHeight,
+		"arrival":         l.Arrival,
+		"join":            strings.Join,
+	}
+}
+
+// formatTime はtime.Time、*time.Time、*ReportTimeをlayoutで書式化する。nilなら"不明"
+func formatTime(layout string, v any) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return "不明", nil
+	}
+	return t.Format(layout), nil
+}
+
+// toTime はテンプレートに渡された時刻を*time.Timeにする
+func toTime(v any) (*time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return &t, nil
+	case *time.Time:
+		return t, nil
+	case *ReportTime:
+		return (*time.Time)(t), nil
+	}
+	return nil, fmt.Errorf("unsupported time type %T", v)
+}
+
+func mustTemplates() map[Language]*template.Template {
+	m := make(map[Language]*template.Template)
+	for l, file := range templateFiles {
+		m[l] = template.Must(template.New("").Funcs(funcs(l)).ParseFS(templates, file))
+	}
+	return m
+}
+
+// NewRenderer はlangsの既定のテンプレートをfileで上書きしたRendererを作る。
+// fileが空なら既定のまま、langsが空なら日本語のみ
+func NewRenderer(file string, langs ...Language) (*Renderer, error) {
+	if len(langs) == 0 {
+		langs = []Language{LanguageJapanese}
+	}
+	var r Renderer
+	for _, l := range langs {
+		t, ok := baseTemplates[l]
+		if !ok {
+			return nil, fmt.Errorf("unsupported language: %s", l)
+		}
+		if file != "" {
+			var err error
+			if t, err = t.Clone(); err != nil {
+				return nil, err
+			}
+			if _, err := t.ParseFiles(file); err != nil {
+				return nil, err
+			}
+		}
+		r.sets = append(r.sets, localized{l, t})
+	}
+	return &r, nil
+}
+
+// WithLimit はlimitに収まるよう投稿文を短くするRendererを返す
+func (r *Renderer) WithLimit(limit Limit) *Renderer {
+	n := *r
+	n.limit = limit
+	return &n
+}
+
+// Language は投稿文の言語。複数の言語を持つ場合は最初のもの
+func (r *Renderer) Language() Language {
+	return r.sets[0].lang
+}
+
+// TemplateName はcontentの投稿に使うテンプレートの名前
+func TemplateName(c *Content) string {
+	switch {
+	case c.IsCanceled():
+		return TemplateCancel
+	case c.IsTsunami():
+		return TemplateTsunami
+	case c.IsEarthquakeInfo():
+		return TemplateEarthquake
+	case c.IsWarning():
+		return TemplateWarning
+	case bool(c.IsLast):
+		return TemplateFinal
+	case c.Serial <= 1:
+		return TemplateFirst
+	}
+	return TemplateUpdate
+}
+
+// Render はcontentの投稿文を作る。trainingなら訓練・試験であることを示す。
+// 上限に収まらなければ補足から順に省き、それでも収まらなければ切り詰める
+func (r *Renderer) Render(c *Content, training bool) (string, error) {
+	var text string
+	for shorten := 0; shorten <= ShortenList; shorten++ {
+		var err error
+		if text, err = r.render(c, training, shorten); err != nil {
+			return "", err
+		}
+		if r.limit.Fits(text) {
+			return text, nil
+		}
+	}
+	return r.limit.Truncate(text), nil
+}
+
+func (r *Renderer) render(c *Content, training bool, shorten int) (string, error) {
+	texts := make([]string, 0, len(r.sets))
+	for _, set := range r.sets {
+		d := Data{Content: c, Language: set.lang, Shorten: shorten}
+		text, err := set.execute(TemplateName(c), d)
+		if err != nil {
+			return "", err
+		}
+		if training {
+			d.Message = text
+			if text, err = set.execute(TemplateTraining, d); err != nil {
+				return "", err
+			}
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// altLimit は代替テキストの上限。Mastodonの既定の1500文字に収める
+var altLimit = Limit{Max: 1500}
+
+// Alt はcontentの地図画像の代替テキストを作る
+func (r *Renderer) Alt(c *Content) (string, error) {
+	texts := make([]string, 0, len(r.sets))
+	for _, set := range r.sets {
+		text, err := set.execute(TemplateAlt, Data{Content: c, Language: set.lang})
+		if err != nil {
+			return "", err
+		}
+		texts = append(texts, text)
+	}
+	return altLimit.Truncate(strings.Join(texts, "\n\n")), nil
+}
+
+func (set localized) execute(name string, d Data) (string, error) {
+	var b strings.Builder
+	if err := set.t.ExecuteTemplate(&b, name, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,222 @@
+package eew
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// samples以下の電文を言語ごとに既定のテンプレートで投稿文にしてtestdata/golden以下と比べる。
+// 日本語は<sample>.txt、それ以外は<sample>.<lang>.txt
+func TestRenderGolden(t *testing.T) {
+	files, err := filepath.Glob("samples/*")
+	if err != nil {
+		t.Fatalf("failed to glob samples: %v", err)
+	}
+	for _, lang := range Languages {
+		r, err := NewRenderer("", lang)
+		if err != nil {
+			t.Fatalf("failed to create renderer for %s: %v", lang, err)
+		}
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", file, err)
+			}
+			base := filepath.Base(file)
+			// 77_01_01_110311_VXSE45.xml のような名前から種類を取り出す
+			typ := strings.TrimSuffix(base[strings.LastIndex(base, "_")+1:], filepath.Ext(base))
+			c, err := Telegram{Type: typ, Body: b}.Content()
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", file, err)
+			}
+			got, err := r.Render(c, false)
+			if err != nil {
+				t.Fatalf("failed to render %s in %s: %v", file, lang, err)
+			}
+			golden := filepath.Join("testdata", "golden", base+".txt")
+			if lang != LanguageJapanese {
+				golden = filepath.Join("testdata", "golden", base+"."+string(lang)+".txt")
+			}
+			if *update {
+				if err := os.WriteFile(golden, []byte(got+"\n"), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", golden, err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", golden, err)
+			}
+			if got != strings.TrimSuffix(string(want), "\n") {
+				t.Errorf("%s: got:%s want:%s", golden, got, want)
+			}
+		}
+	}
+}
+
+func TestTemplateName(t *testing.T) {
+	tests := []struct {
+		Content *Content
+		Want    string
+	}{
+		{&Content{Serial: 1}, TemplateFirst},
+		{&Content{Serial: 2}, TemplateUpdate},
+		{&Content{Serial: 3, IsLast: true}, TemplateFinal},
+		{&Content{Serial: 1, InfoType: InfoTypeCancel}, TemplateCancel},
+		{&Content{Serial: 1, Title: TitleWarning}, TemplateWarning},
+		{&Content{Title: TitleIntensity}, TemplateEarthquake},
+		{&Content{Title: TitleTsunamiWarning}, TemplateTsunami},
+	}
+	for _, tt := range tests {
+		if got := TemplateName(tt.Content); got != tt.Want {
+			t.Errorf("%+v: got:%s want:%s", tt.Content, got, tt.Want)
+		}
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	r, err := NewRenderer("testdata/override.tmpl")
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	b, err := os.ReadFile("samples/77_01_01_110311_VXSE45.xml")
+	if err != nil {
+		t.Fatalf("failed to read sample: %v", err)
+	}
+	c, err := Telegram{Type: "VXSE45", Body: b}.Content()
+	if err != nil {
+		t.Fatalf("failed to parse sample: %v", err)
+	}
+	c.Status = StatusTraining
+	got, err := r.Render(c, true)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	// 上書きしたテンプレートでもtrainingは既定のまま
+	if want := "【訓練】[第23報] 三陸沖 M8.4 震度6強 14:46:"; !strings.HasPrefix(got, want) {
+		t.Errorf("got:%s want prefix:%s", got, want)
+	}
+	// 上書きしていないテンプレートは既定のまま
+	c.InfoType = InfoTypeCancel
+	got, err = r.Render(c, false)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	if want := "**緊急地震速報（予報）** 第23報 *取消*"; !strings.HasPrefix(got, want) {
+		t.Errorf("got:%s want prefix:%s", got, want)
+	}
+	if _, err := NewRenderer("testdata/notfound.tmpl"); err == nil {
+		t.Errorf("no error for missing template")
+	}
+}
+
+func TestRenderLanguages(t *testing.T) {
+	r, err := NewRenderer("", LanguageJapanese, LanguageEnglish)
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	if got := r.Language(); got != LanguageJapanese {
+		t.Errorf("language got:%s want:%s", got, LanguageJapanese)
+	}
+	c := &Content{Status: StatusTraining, InfoType: InfoTypeCancel, Serial: 2}
+	got, err := r.Render(c, true)
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	want := "【訓練】**緊急地震速報（予報）** 第2報 *取消*\n先ほどの緊急地震速報（予報）を取り消します。\n\n" +
+		"[TRAINING] **Earthquake Early Warning (Forecast)** #2 *Canceled*\nThe previous Earthquake Early Warning (Forecast) has been canceled."
+	if got != want {
+		t.Errorf("got:%q want:%q", got, want)
+	}
+	if _, err := NewRenderer("", Language("fr")); err == nil {
+		t.Errorf("no error for unsupported language")
+	}
+}
+
+// 上限に収まるまで補足、震央の詳細、一覧の順に省き、最後はURLを残して切り詰める
+func TestRenderLimit(t *testing.T) {
+	b, err := os.ReadFile("samples/77_01_05_110311_VXSE53.xml")
+	if err != nil {
+		t.Fatalf("failed to read sample: %v", err)
+	}
+	c, err := Telegram{Type: "VXSE53", Body: b}.Content()
+	if err != nil {
+		t.Fatalf("failed to parse sample: %v", err)
+	}
+	c.AreaName = "茨城県南部"
+	c.ReduceName = "茨城県"
+	tests := []struct {
+		Limit    Limit
+		Contains []string
+		Excludes []string
+	}{
+		{Limit{}, []string{"茨城県南部（北緯38度、東経142.9度）", "宮城県：震度7", "津波警報等"}, nil},
+		{Limit{Max: 260}, []string{"茨城県南部（北緯38度、東経142.9度）", "宮城県：震度7"}, []string{"津波警報等"}},
+		{Limit{Max: 240}, []string{"震源地は茨城県で", "宮城県：震度7"}, []string{"北緯"}},
+		{Limit{Max: 200, Count: CountGraphemes}, []string{"震源地は茨城県で", "最大震度は震度7"}, []string{"宮城県：震度7"}},
+		{Limit{Max: 120}, []string{"…\nhttps://"}, []string{"最大震度"}},
+	}
+	for _, tt := range tests {
+		got, err := DefaultRenderer.WithLimit(tt.Limit).Render(c, false)
+		if err != nil {
+			t.Fatalf("failed to render: %v", err)
+		}
+		if !tt.Limit.Fits(got) {
+			t.Errorf("%+v: too long %d: %s", tt.Limit, tt.Limit.Len(got), got)
+		}
+		if !strings.HasSuffix(got, "2011-03-11-14-46-40.html") {
+			t.Errorf("%+v: url is dropped: %s", tt.Limit, got)
+		}
+		for _, s := range tt.Contains {
+			if !strings.Contains(got, s) {
+				t.Errorf("%+v: %q is not contained: %s", tt.Limit, s, got)
+			}
+		}
+		for _, s := range tt.Excludes {
+			if strings.Contains(got, s) {
+				t.Errorf("%+v: %q is contained: %s", tt.Limit, s, got)
+			}
+		}
+	}
+	// WithLimitは元のRendererを変えない
+	if got, _ := DefaultRenderer.Render(c, false); !strings.Contains(got, "津波警報等") {
+		t.Errorf("DefaultRenderer is shortened: %s", got)
+	}
+}
+
+// 地図画像の代替テキストは言語ごとに震度の高い順に区域を並べる
+func TestRenderAlt(t *testing.T) {
+	b, err := os.ReadFile("samples/77_01_03_110311_VXSE51.xml")
+	if err != nil {
+		t.Fatalf("failed to read sample: %v", err)
+	}
+	c, err := Telegram{Type: "VXSE51", Body: b}.Content()
+	if err != nil {
+		t.Fatalf("failed to parse sample: %v", err)
+	}
+	r, err := NewRenderer("", LanguageJapanese, LanguageEnglish)
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	got, err := r.Alt(c)
+	if err != nil {
+		t.Fatalf("failed to render alt: %v", err)
+	}
+	for _, want := range []string{
+		"観測された震度の分布図。\n震度7：宮城県北部\n震度6強：宮城県南部、",
+		"\n\nMap of observed seismic intensities.\nShindo 7: Northern Miyagi Prefecture\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:%q want:%q", got, want)
+		}
+	}
+	// 震度のない取消報は震央もなければ地図の説明だけ
+	if got, _ := DefaultRenderer.Alt(&Content{InfoType: InfoTypeCancel}); got != "震央の地図。" {
+		t.Errorf("cancel got:%q", got)
+	}
+}
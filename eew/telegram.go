@@ -0,0 +1,54 @@
+package eew
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// Telegram はZeroMQで流す電文
+// Frames: [0]種別 [1]本文 [2]試験フラグ
+type Telegram struct {
+	Type string
+	Body []byte
+	// WebsocketData.Head.Test
+	Test bool
+}
+
+func (t Telegram) Msg() zmq4.Msg {
+	test := "0"
+	if t.Test {
+		test = "1"
+	}
+	return zmq4.NewMsgFrom([]byte(t.Type), t.Body, []byte(test))
+}
+
+func ParseMsg(msg zmq4.Msg) (*Telegram, error) {
+	if len(msg.Frames) < 2 {
+		return nil, fmt.Errorf("too few frames: %d", len(msg.Frames))
+	}
+	t := Telegram{
+		Type: string(msg.Frames[0]),
+		Body: msg.Frames[1],
+	}
+	// 試験フラグのない古い形式も受け付ける
+	if len(msg.Frames) > 2 {
+		t.Test = string(msg.Frames[2]) == "1"
+	}
+	return &t, nil
+}
+
+// Content は電文を解析する。XML形式とJSON形式のどちらも受け付ける
+func (t Telegram) Content() (*Content, error) {
+	parse := NewContent
+	if IsJSON(t.Body) {
+		parse = NewContentJSON
+	}
+	c, err := parse(bytes.NewReader(t.Body))
+	if err != nil {
+		return nil, err
+	}
+	c.Test = t.Test
+	return c, nil
+}
@@ -0,0 +1,291 @@
+package eew
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// TsunamiCategory は津波予報区ごとの警報・注意報・予報の種類。大きいほど危険
+type TsunamiCategory int
+
+const (
+	// 津波なし、警報・注意報の解除
+	TsunamiNone TsunamiCategory = iota
+	// 津波予報（若干の海面変動）
+	TsunamiForecast
+	TsunamiAdvisory
+	TsunamiWarning
+	TsunamiMajorWarning
+)
+
+func (c TsunamiCategory) String() string {
+	switch c {
+	case TsunamiForecast:
+		return "津波予報"
+	case TsunamiAdvisory:
+		return "津波注意報"
+	case TsunamiWarning:
+		return "津波警報"
+	case TsunamiMajorWarning:
+		return "大津波警報"
+	}
+	return "津波なし"
+}
+
+// IsWarning は津波警報以上かどうか
+func (c TsunamiCategory) IsWarning() bool {
+	return c >= TsunamiWarning
+}
+
+// ParseTsunamiCategory は警報等情報要素／津波警報・注意報・予報のコードを変換する
+func ParseTsunamiCategory(code string) TsunamiCategory {
+	switch code {
+	case "52", "53":
+		return TsunamiMajorWarning
+	case "51":
+		return TsunamiWarning
+	case "62":
+		return TsunamiAdvisory
+	case "71", "72", "73":
+		return TsunamiForecast
+	}
+	// 00: 津波なし、50: 警報解除、60: 津波注意報解除
+	return TsunamiNone
+}
+
+// TsunamiHeight は津波の高さ
+type TsunamiHeight struct {
+	// 巨大、高いなど数値で表せない場合はNaN
+	Value float64
+	// "３ｍ"、"１０ｍ超"、"巨大"など
+	Description string
+}
+
+func (h *TsunamiHeight) String() string {
+	if h == nil {
+		return "不明"
+	}
+	if h.Description != "" {
+		return h.Description
+	}
+	if math.IsNaN(h.Value) {
+		return "不明"
+	}
+	return strconv.FormatFloat(h.Value, 'f', -1, 64) + "m"
+}
+
+// TsunamiArea は津波予報区ごとの予報
+type TsunamiArea struct {
+	Name     string
+	Code     string
+	Kind     Kind
+	LastKind Kind
+	Category TsunamiCategory
+	// 第1波の到達予想時刻
+	ArrivalTime *time.Time
+	// ただちに津波来襲と予測、第１波の到達を確認 など
+	Condition string
+	// 予想される津波の高さ
+	Height *TsunamiHeight
+}
+
+// TsunamiStation は潮位観測点で観測された津波
+type TsunamiStation struct {
+	AreaName string
+	Name     string
+	Code     string
+	// 第1波の到達時刻
+	ArrivalTime *time.Time
+	// 押し、引き
+	Initial string
+	// これまでの最大波の時刻
+	MaxTime   *time.Time
+	MaxHeight *TsunamiHeight
+}
+
+// Tsunami は津波警報・注意報・予報、津波情報の内容
+type Tsunami struct {
+	Areas []TsunamiArea
+	// 津波情報で観測された津波
+	Stations []TsunamiStation
+}
+
+// Max は発表中の最も危険な種類
+func (t *Tsunami) Max() TsunamiCategory {
+	if t == nil {
+		return TsunamiNone
+	}
+	m := TsunamiNone
+	for _, a := range t.Areas {
+		m = max(m, a.Category)
+	}
+	return m
+}
+
+// HasAdvisory は津波注意報以上が発表されているかどうか
+func (t *Tsunami) HasAdvisory() bool {
+	return t.Max() >= TsunamiAdvisory
+}
+
+// TsunamiGroup は同じ種類の予報区をまとめたもの
+type TsunamiGroup struct {
+	Category TsunamiCategory
+	Areas    []TsunamiArea
+}
+
+// Groups は大津波警報、津波警報、津波注意報の順に予報区をまとめる。予報区のない種類は含めない
+func (t *Tsunami) Groups() []TsunamiGroup {
+	if t == nil {
+		return nil
+	}
+	var groups []TsunamiGroup
+	for _, cat := range []TsunamiCategory{TsunamiMajorWarning, TsunamiWarning, TsunamiAdvisory} {
+		g := TsunamiGroup{Category: cat}
+		for _, a := range t.Areas {
+			if a.Category == cat {
+				g.Areas = append(g.Areas, a)
+			}
+		}
+		if len(g.Areas) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// IsCleared は警報・注意報がすべて解除されたかどうか
+func (t *Tsunami) IsCleared() bool {
+	if t == nil || t.Max() >= TsunamiAdvisory {
+		return false
+	}
+	for _, a := range t.Areas {
+		if ParseTsunamiCategory(a.LastKind.Code) >= TsunamiAdvisory {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTsunamiHeight(n *xmlquery.Node) (*TsunamiHeight, error) {
+	v := n.SelectElement("jmx_eb:TsunamiHeight")
+	if v == nil {
+		return nil, nil
+	}
+	h := TsunamiHeight{
+		Value:       math.NaN(),
+		Description: v.SelectAttr("description"),
+	}
+	if s := v.InnerText(); s != "" && s != "NaN" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		h.Value = f
+	}
+	return &h, nil
+}
+
+func parseTime(n *xmlquery.Node) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, n.InnerText())
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseTsunami(root *xmlquery.Node) (*Tsunami, error) {
+	n := root.SelectElement("//Body/Tsunami")
+	if n == nil {
+		return nil, nil
+	}
+	var t Tsunami
+	for _, item := range xmlquery.Find(n, "Forecast/Item") {
+		var a TsunamiArea
+		if v := item.SelectElement("Area/Name"); v != nil {
+			a.Name = v.InnerText()
+		}
+		if v := item.SelectElement("Area/Code"); v != nil {
+			a.Code = v.InnerText()
+		}
+		if v := item.SelectElement("Category/Kind"); v != nil {
+			a.Kind = parseKind(v)
+		}
+		if v := item.SelectElement("Category/LastKind"); v != nil {
+			a.LastKind = parseKind(v)
+		}
+		a.Category = ParseTsunamiCategory(a.Kind.Code)
+		if v := item.SelectElement("FirstHeight/ArrivalTime"); v != nil {
+			at, err := parseTime(v)
+			if err != nil {
+				return nil, err
+			}
+			a.ArrivalTime = at
+		}
+		if v := item.SelectElement("FirstHeight/Condition"); v != nil {
+			a.Condition = v.InnerText()
+		}
+		if v := item.SelectElement("MaxHeight"); v != nil {
+			h, err := parseTsunamiHeight(v)
+			if err != nil {
+				return nil, err
+			}
+			a.Height = h
+		}
+		t.Areas = append(t.Areas, a)
+	}
+	for _, item := range xmlquery.Find(n, "Observation/Item") {
+		var areaName string
+		if v := item.SelectElement("Area/Name"); v != nil {
+			areaName = v.InnerText()
+		}
+		for _, st := range item.SelectElements("Station") {
+			s := TsunamiStation{AreaName: areaName}
+			if v := st.SelectElement("Name"); v != nil {
+				s.Name = v.InnerText()
+			}
+			if v := st.SelectElement("Code"); v != nil {
+				s.Code = v.InnerText()
+			}
+			if v := st.SelectElement("FirstHeight/ArrivalTime"); v != nil {
+				at, err := parseTime(v)
+				if err != nil {
+					return nil, err
+				}
+				s.ArrivalTime = at
+			}
+			if v := st.SelectElement("FirstHeight/Initial"); v != nil {
+				s.Initial = v.InnerText()
+			}
+			if v := st.SelectElement("MaxHeight/DateTime"); v != nil {
+				mt, err := parseTime(v)
+				if err != nil {
+					return nil, err
+				}
+				s.MaxTime = mt
+			}
+			if v := st.SelectElement("MaxHeight"); v != nil {
+				h, err := parseTsunamiHeight(v)
+				if err != nil {
+					return nil, err
+				}
+				s.MaxHeight = h
+			}
+			t.Stations = append(t.Stations, s)
+		}
+	}
+	return &t, nil
+}
+
+// Arrival は到達予想時刻か、なければ状況を返す
+func (a TsunamiArea) Arrival() string {
+	if a.Condition != "" {
+		return a.Condition
+	}
+	if a.ArrivalTime != nil {
+		return a.ArrivalTime.Format("15時04分") + "到達予想"
+	}
+	return ""
+}
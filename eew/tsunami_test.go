@@ -0,0 +1,131 @@
+package eew
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestParseTsunamiCategory(t *testing.T) {
+	tests := []struct {
+		Code string
+		Want TsunamiCategory
+	}{
+		{"52", TsunamiMajorWarning},
+		{"53", TsunamiMajorWarning},
+		{"51", TsunamiWarning},
+		{"62", TsunamiAdvisory},
+		{"71", TsunamiForecast},
+		{"50", TsunamiNone},
+		{"00", TsunamiNone},
+		{"", TsunamiNone},
+	}
+	for _, tt := range tests {
+		if got := ParseTsunamiCategory(tt.Code); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Code, got, tt.Want)
+		}
+	}
+}
+
+func TestParseTsunami(t *testing.T) {
+	tests := []struct {
+		File     string
+		Title    string
+		Areas    map[TsunamiCategory]int
+		Stations int
+	}{
+		{
+			File:  "samples/77_01_06_110311_VTSE41.xml",
+			Title: TitleTsunamiWarning,
+			Areas: map[TsunamiCategory]int{TsunamiMajorWarning: 3, TsunamiWarning: 4, TsunamiAdvisory: 4},
+		},
+		{
+			File:     "samples/77_01_07_110311_VTSE51.xml",
+			Title:    TitleTsunamiInfo,
+			Areas:    map[TsunamiCategory]int{TsunamiMajorWarning: 3, TsunamiWarning: 4, TsunamiAdvisory: 4},
+			Stations: 3,
+		},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(tt.File)
+		if err != nil {
+			t.Fatalf("failed to open sample xml: %v", tt.File)
+		}
+		content, err := NewContent(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to parseXml: %v", err)
+		}
+		if !content.IsTsunami() || content.Title != tt.Title {
+			t.Errorf("%s: title got:%s want:%s", tt.File, content.Title, tt.Title)
+		}
+		if content.IsEarthquakeInfo() || content.IsWarning() {
+			t.Errorf("%s: tsunami must not be earthquake info or warning", tt.File)
+		}
+		if content.ReportDateTime.IsZero() {
+			t.Errorf("%s: ReportDateTime is zero", tt.File)
+		}
+		ts := content.Tsunami
+		if ts == nil {
+			t.Fatalf("%s: Tsunami got:nil", tt.File)
+		}
+		if got := ts.Max(); got != TsunamiMajorWarning {
+			t.Errorf("%s: Max got:%v want:%v", tt.File, got, TsunamiMajorWarning)
+		}
+		if ts.IsCleared() {
+			t.Errorf("%s: IsCleared got:true want:false", tt.File)
+		}
+		areas := make(map[TsunamiCategory]int)
+		for _, a := range ts.Areas {
+			areas[a.Category]++
+		}
+		for cat, want := range tt.Areas {
+			if areas[cat] != want {
+				t.Errorf("%s: %v got:%d want:%d", tt.File, cat, areas[cat], want)
+			}
+		}
+		if a := ts.Areas[1]; a.Name != "宮城県" || a.Height.String() != "６ｍ" || a.Arrival() != "15時00分到達予想" {
+			t.Errorf("%s: unexpected area: %+v", tt.File, a)
+		}
+		// 到達予想時刻を過ぎた予報区は状況のみ
+		if a := ts.Areas[7]; a.ArrivalTime != nil || a.Arrival() != "津波到達中と推測" {
+			t.Errorf("%s: unexpected area: %+v", tt.File, a)
+		}
+		if len(ts.Stations) != tt.Stations {
+			t.Errorf("%s: stations got:%d want:%d", tt.File, len(ts.Stations), tt.Stations)
+		}
+	}
+}
+
+func TestTsunamiHeight(t *testing.T) {
+	tests := []struct {
+		Height *TsunamiHeight
+		Want   string
+	}{
+		{nil, "不明"},
+		{&TsunamiHeight{Value: 3, Description: "３ｍ"}, "３ｍ"},
+		{&TsunamiHeight{Value: 0.5}, "0.5m"},
+		{&TsunamiHeight{Value: math.NaN()}, "不明"},
+	}
+	for _, tt := range tests {
+		if got := tt.Height.String(); got != tt.Want {
+			t.Errorf("got:%s want:%s", got, tt.Want)
+		}
+	}
+}
+
+func TestTsunamiIsCleared(t *testing.T) {
+	cleared := &Tsunami{Areas: []TsunamiArea{
+		{Category: TsunamiNone, LastKind: Kind{Code: "62"}},
+		{Category: TsunamiForecast, LastKind: Kind{Code: "51"}},
+	}}
+	if !cleared.IsCleared() {
+		t.Errorf("IsCleared got:false want:true")
+	}
+	forecast := &Tsunami{Areas: []TsunamiArea{
+		{Category: TsunamiForecast, LastKind: Kind{Code: "00"}},
+	}}
+	if forecast.IsCleared() {
+		t.Errorf("IsCleared got:true want:false")
+	}
+}
@@ -0,0 +1,67 @@
+package eew
+
+import (
+	"context"
+
+	"github.com/go-zeromq/zmq4"
+	"golang.org/x/exp/slog"
+)
+
+// Subscriber はZeroMQから電文を受け取る
+type Subscriber struct {
+	sub zmq4.Socket
+}
+
+func Subscribe(ctx context.Context, endpoint string, topics ...string) (*Subscriber, error) {
+	sub := zmq4.NewSub(ctx, zmq4.WithAutomaticReconnect(true))
+	if err := sub.Dial(endpoint); err != nil {
+		slog.Error("Failed to dial zmq4 pubsub", err, slog.Any("zmq", endpoint))
+		sub.Close()
+		return nil, err
+	}
+	for _, topic := range topics {
+		if err := sub.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+			slog.Error("Failed to set option for subscribe", err, slog.Any("topic", topic))
+			sub.Close()
+			return nil, err
+		}
+	}
+	slog.Info("Succeed to dial zmq4 pubsub", slog.Any("endpoint", endpoint), slog.Any("topics", topics))
+	return &Subscriber{sub: sub}, nil
+}
+
+func (s *Subscriber) Recv() (*Telegram, error) {
+	msg, err := s.sub.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return ParseMsg(msg)
+}
+
+func (s *Subscriber) Close() error {
+	return s.sub.Close()
+}
+
+// Publisher はZeroMQのPUBソケットへ電文を流す
+type Publisher struct {
+	pub zmq4.Socket
+}
+
+func Listen(ctx context.Context, endpoint string) (*Publisher, error) {
+	pub := zmq4.NewPub(ctx)
+	if err := pub.Listen(endpoint); err != nil {
+		slog.Error("Failed to listen zmq4 pubsub", err)
+		pub.Close()
+		return nil, err
+	}
+	slog.Info("Succeed to listen zmq4 pubsub", slog.Any("endpoint", endpoint))
+	return &Publisher{pub: pub}, nil
+}
+
+func (p *Publisher) Send(_ context.Context, t Telegram) error {
+	return p.pub.Send(t.Msg())
+}
+
+func (p *Publisher) Close() error {
+	return p.pub.Close()
+}
@@ -0,0 +1,102 @@
+// Package cli はnamazuと各namazu2*コマンドの実装
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/matsuu/namazu/config"
+	"github.com/matsuu/namazu/eew"
+	"golang.org/x/exp/slog"
+)
+
+// Main はSIGINT/SIGTERMでキャンセルされるctxでfを実行し、失敗したら終了する
+func Main(f func(ctx context.Context, args []string) error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := f(ctx, os.Args[1:]); err != nil {
+		slog.Error("Failed to run", err)
+		os.Exit(1)
+	}
+}
+
+// commonFlags は各コマンド共通のフラグ
+type commonFlags struct {
+	configFile  string
+	zmqEndpoint string
+	stateFile   string
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet, zmqUsage string) {
+	fs.StringVar(&c.configFile, "config", "", "path to config file. other flags are ignored if specified")
+	fs.StringVar(&c.zmqEndpoint, "zmq", eew.DefaultZmqEndpoint, zmqUsage)
+}
+
+func (c *commonFlags) registerState(fs *flag.FlagSet) {
+	fs.StringVar(&c.stateFile, "state-file", "", "path to file to keep posted threads across restarts (in memory if empty)")
+}
+
+// load は設定ファイルがあれば読み込み、なければフラグと環境変数から設定を作る
+func (c *commonFlags) load(fromFlags func(cfg *config.Config)) (*config.Config, error) {
+	if c.configFile == "" {
+		c.configFile = os.Getenv("NAMAZU_CONFIG")
+	}
+
+	var cfg *config.Config
+	var err error
+	if c.configFile != "" {
+		cfg, err = config.Load(c.configFile)
+	} else {
+		if c.zmqEndpoint == eew.DefaultZmqEndpoint {
+			if v := os.Getenv("ZMQ_ENDPOINT"); v != "" {
+				c.zmqEndpoint = os.Getenv("ZMQ_ENDPOINT")
+			}
+		}
+
+		if c.stateFile == "" {
+			c.stateFile = os.Getenv("STATE_FILE")
+		}
+
+		cfg = config.Default()
+		cfg.ZeroMQ.Endpoint = c.zmqEndpoint
+		cfg.State.File = c.stateFile
+		fromFlags(cfg)
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.Log.SetupLog(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Namazu はサブコマンドを実行する。サブコマンドを省略した場合はreceive
+func Namazu(ctx context.Context, args []string) error {
+	cmd := "receive"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "receive":
+		return Receive(ctx, args)
+	case "serve":
+		return Serve(ctx, args)
+	case "sink":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: namazu sink {mastodon|bluesky|nostr|mixi2} [flags]")
+		}
+		return Sink(ctx, args[0], args[1:])
+	case "replay":
+		return Replay(ctx, args)
+	case "mock-dmdata":
+		return MockDMData(ctx, args)
+	}
+	return fmt.Errorf("unknown command: %s\nusage: namazu {receive|serve|sink|replay|mock-dmdata} [flags]", cmd)
+}
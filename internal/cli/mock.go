@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/matsuu/namazu/mockdmdata"
+	"golang.org/x/exp/slog"
+)
+
+// MockDMData はXMLやJSONの電文を流すDMDATA.JPのmockを起動する
+func MockDMData(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mock-dmdata", flag.ExitOnError)
+
+	opts := mockdmdata.DefaultOptions()
+
+	var listen string
+	fs.StringVar(&listen, "listen", "127.0.0.1:8080", "address to listen")
+	fs.StringVar(&opts.ApiKey, "apikey", "", "API Key to accept (any if empty)")
+	fs.DurationVar(&opts.Delay, "delay", opts.Delay, "delay before first telegram")
+	fs.DurationVar(&opts.Interval, "interval", opts.Interval, "interval between telegrams")
+	fs.DurationVar(&opts.PingInterval, "ping", opts.PingInterval, "interval between pings")
+	fs.StringVar(&opts.Encoding, "encoding", opts.Encoding, "encoding of body: base64, utf-8")
+	fs.StringVar(&opts.Compression, "compression", opts.Compression, "compression of body: gzip, zip or empty")
+	fs.BoolVar(&opts.Loop, "loop", false, "repeat telegrams")
+	fs.BoolVar(&opts.Test, "test", false, "mark telegrams as test")
+
+	fs.Parse(args)
+
+	files, err := mockdmdata.ExpandFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	opts.Files = files
+	s, err := mockdmdata.NewServer(opts)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: s.Handler(),
+	}
+	context.AfterFunc(ctx, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	slog.Info("Listen", slog.Any("addr", listen), slog.Any("files", len(files)))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
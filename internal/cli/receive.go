@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/matsuu/namazu/archive"
+	"github.com/matsuu/namazu/config"
+	"github.com/matsuu/namazu/eew"
+)
+
+// Receive はDMDATA.JPから受け取った電文をZeroMQのPUBソケットへ流す
+func Receive(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ExitOnError)
+
+	var c commonFlags
+	c.register(fs, "zeromq endpoint")
+
+	var apiKey string
+	fs.StringVar(&apiKey, "apikey", "", "API Key for dmdata.jp")
+
+	var apiBase string
+	fs.StringVar(&apiBase, "api-base", eew.DefaultApiBase, "base url of dmdata.jp API")
+
+	var format string
+	fs.StringVar(&format, "format", "xml", "format of telegrams: xml, json")
+
+	var classifications string
+	fs.StringVar(&classifications, "classifications", eew.ClassificationForecast, "comma separated classifications to receive: eew.forecast, eew.warning, telegram.earthquake")
+
+	var archiveDir string
+	fs.StringVar(&archiveDir, "archive-dir", "", "directory to archive raw telegrams (disabled if empty)")
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {
+		if apiKey == "" {
+			apiKey = os.Getenv("DMDATA_API_KEY")
+		}
+		if apiBase == eew.DefaultApiBase {
+			if v := os.Getenv("DMDATA_API_BASE"); v != "" {
+				apiBase = v
+			}
+		}
+		if classifications == eew.ClassificationForecast {
+			if v := os.Getenv("DMDATA_CLASSIFICATIONS"); v != "" {
+				classifications = v
+			}
+		}
+		if archiveDir == "" {
+			archiveDir = os.Getenv("ARCHIVE_DIR")
+		}
+		cfg.DMData.ApiKey = config.Secret(apiKey)
+		cfg.Archive.Dir = archiveDir
+		cfg.DMData.ApiBase = apiBase
+		cfg.DMData.Format = format
+		cfg.DMData.Classifications = strings.Split(classifications, ",")
+	})
+	if err != nil {
+		return err
+	}
+	if cfg.DMData.ApiKey == "" {
+		return config.ErrNoApiKey
+	}
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		return err
+	}
+	return eew.Run(ctx, string(cfg.DMData.ApiKey), cfg.ZeroMQ.Endpoint, opts...)
+}
+
+// clientOptions はcfgからeew.Clientの設定を作る
+func clientOptions(cfg *config.Config) ([]eew.ClientOption, error) {
+	opts := []eew.ClientOption{
+		eew.WithApiBase(cfg.DMData.ApiBase),
+		eew.WithFormat(cfg.DMData.Format),
+		eew.WithClassifications(cfg.DMData.Classifications...),
+	}
+	if cfg.Archive.Dir != "" {
+		a, err := archive.New(cfg.Archive.Dir)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, eew.WithArchiver(a))
+	}
+	return opts, nil
+}
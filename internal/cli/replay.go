@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/matsuu/namazu/config"
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/replay"
+	"golang.org/x/exp/slog"
+)
+
+// Replay は保存しておいた電文をZeroMQのPUBソケットへ流し直す
+func Replay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+
+	var c commonFlags
+	c.register(fs, "zeromq endpoint")
+
+	var p replay.Player
+	fs.Float64Var(&p.Speed, "speed", 1, "playback speed. 1 for original timing, 0 for no wait")
+	fs.DurationVar(&p.MaxGap, "max-gap", time.Minute, "max wait between telegrams. 0 for no limit")
+
+	var wait time.Duration
+	fs.DurationVar(&wait, "wait", 3*time.Second, "wait for subscribers to connect before replay")
+
+	var test bool
+	fs.BoolVar(&test, "test", false, "mark telegrams as test")
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {})
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: namazu replay [flags] {xml|json|dir|zip|tar.gz}...")
+	}
+	items, err := replay.Load(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return errors.New("no telegrams")
+	}
+	for i := range items {
+		items[i].Telegram.Test = test
+	}
+
+	pub, err := eew.Listen(ctx, cfg.ZeroMQ.Endpoint)
+	if err != nil {
+		return err
+	}
+	defer pub.Close()
+
+	// PUBは接続前のSUBには届かないので待つ
+	slog.Info("Wait for subscribers", slog.Any("wait", wait), slog.Any("telegrams", len(items)))
+	t := time.NewTimer(wait)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return nil
+	case <-t.C:
+	}
+
+	if err := p.Play(ctx, items, pub); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
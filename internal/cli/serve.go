@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/matsuu/namazu/config"
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/errgroup"
+)
+
+// Serve はDMDATA.JPからの受信と設定された全SNSへの投稿を1プロセスで行う
+// ZeroMQは使わずプロセス内のeew.Busで電文を受け渡す
+func Serve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var configFile string
+	fs.StringVar(&configFile, "config", "", "path to config file")
+
+	fs.Parse(args)
+
+	if configFile == "" {
+		configFile = os.Getenv("NAMAZU_CONFIG")
+	}
+	if configFile == "" {
+		return errors.New("serve requires -config or NAMAZU_CONFIG")
+	}
+	c := commonFlags{configFile: configFile}
+	cfg, err := c.load(nil)
+	if err != nil {
+		return err
+	}
+	if cfg.DMData.ApiKey == "" {
+		return config.ErrNoApiKey
+	}
+	runners := sinkRunners(cfg)
+	if len(runners) == 0 {
+		return errors.New("no sinks are configured")
+	}
+
+	store, err := state.NewFileStore(cfg.State.File)
+	if err != nil {
+		slog.Error("Failed to open state file", err, slog.Any("path", cfg.State.File))
+		return err
+	}
+
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	bus := eew.NewBus()
+	defer bus.Close()
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, r := range runners {
+		r := r
+		src := bus.Subscribe(sink.Topics...)
+		g.Go(func() error {
+			defer src.Close()
+			slog.Info("Succeed to start sink", slog.Any("sink", r.name))
+			return r.run(ctx, src, store)
+		})
+	}
+	g.Go(func() error {
+		return eew.NewClient(string(cfg.DMData.ApiKey), opts...).Run(ctx, bus)
+	})
+	return g.Wait()
+}
@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/matsuu/namazu/bluesky"
+	"github.com/matsuu/namazu/config"
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/mastodon"
+	"github.com/matsuu/namazu/mixi2"
+	"github.com/matsuu/namazu/nostr"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
+	"golang.org/x/exp/slog"
+)
+
+// sinkRunner は設定済みのSNSへの投稿を開始する
+type sinkRunner struct {
+	name string
+	run  func(ctx context.Context, src sink.Source, store state.Store) error
+}
+
+// sinkRunners はcfgで設定されているSNSの一覧を返す
+func sinkRunners(cfg *config.Config) []sinkRunner {
+	var rs []sinkRunner
+	if m := cfg.Sinks.Mastodon; m != nil {
+		rs = append(rs, sinkRunner{"mastodon", func(ctx context.Context, src sink.Source, store state.Store) error {
+			training, _ := m.TrainingMode()
+			renderers, _ := m.Renderers(mastodon.Limit)
+			policy, _ := m.SinkPolicy(sink.ReportsAll)
+			return mastodon.Run(ctx, src, m.Server, string(m.ClientId), string(m.ClientSecret), string(m.AccessToken), training, policy, renderers, m.Map, store)
+		}})
+	}
+	if b := cfg.Sinks.Bluesky; b != nil {
+		rs = append(rs, sinkRunner{"bluesky", func(ctx context.Context, src sink.Source, store state.Store) error {
+			training, _ := b.TrainingMode()
+			renderers, _ := b.Renderers(bluesky.Limit)
+			policy, _ := b.SinkPolicy(sink.ReportsAll)
+			return bluesky.Run(ctx, src, b.PdsHost, b.AuthFile, training, policy, renderers, b.Map, store)
+		}})
+	}
+	if n := cfg.Sinks.Nostr; n != nil {
+		rs = append(rs, sinkRunner{"nostr", func(ctx context.Context, src sink.Source, store state.Store) error {
+			training, _ := n.TrainingMode()
+			renderers, _ := n.Renderers(nostr.Limit)
+			// 続きは最終報のみpostする
+			policy, _ := n.SinkPolicy(sink.ReportsFirstLast)
+			return nostr.Run(ctx, src, string(n.Nsec), n.ImageServer, training, policy, renderers, n.Map, store)
+		}})
+	}
+	if m := cfg.Sinks.Mixi2; m != nil {
+		rs = append(rs, sinkRunner{"mixi2", func(ctx context.Context, src sink.Source, store state.Store) error {
+			training, _ := m.TrainingMode()
+			renderers, _ := m.Renderers(mixi2.Limit)
+			// 続きは最終報のみpostする
+			policy, _ := m.SinkPolicy(sink.ReportsFirstLast)
+			return mixi2.Run(ctx, src, string(m.AuthKey), string(m.AuthToken), m.UserAgent, training, policy, renderers, store)
+		}})
+	}
+	return rs
+}
+
+// Sink はnameのSNSへZeroMQから受け取った電文を投稿する
+func Sink(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "mastodon":
+		return Mastodon(ctx, args)
+	case "bluesky":
+		return Bluesky(ctx, args)
+	case "nostr":
+		return Nostr(ctx, args)
+	case "mixi2":
+		return Mixi2(ctx, args)
+	}
+	return fmt.Errorf("unknown sink: %s", name)
+}
+
+// runSink はZeroMQを購読してnameのSNSへ投稿する
+func runSink(ctx context.Context, cfg *config.Config, name string) error {
+	var r *sinkRunner
+	for _, sr := range sinkRunners(cfg) {
+		if sr.name == name {
+			r = &sr
+			break
+		}
+	}
+	if r == nil {
+		return fmt.Errorf("sinks.%s is not configured", name)
+	}
+
+	store, err := state.NewFileStore(cfg.State.File)
+	if err != nil {
+		slog.Error("Failed to open state file", err, slog.Any("path", cfg.State.File))
+		return err
+	}
+
+	src, err := eew.Subscribe(ctx, cfg.ZeroMQ.Endpoint, sink.Topics...)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := r.run(ctx, src, store); err != nil {
+		return fmt.Errorf("failed to send to %s: %w", name, err)
+	}
+	return nil
+}
+
+// Mastodon はnamazu2mastodonの実装
+func Mastodon(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mastodon", flag.ExitOnError)
+
+	var c commonFlags
+	c.register(fs, "connect to namazu endpoint")
+
+	var mstdnServer string
+	fs.StringVar(&mstdnServer, "mstdn", "", "connect to mastodon instance")
+
+	var clientId string
+	fs.StringVar(&clientId, "client-id", "", "client id for mastodon")
+
+	var clientSecret string
+	fs.StringVar(&clientSecret, "client-secret", "", "client secret for mastodon")
+
+	var accessToken string
+	fs.StringVar(&accessToken, "access-token", "", "access token for mastodon")
+
+	c.registerState(fs)
+
+	var s config.Sink
+	s.RegisterFlags(fs, sink.ReportsAll)
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {
+		if mstdnServer == "" {
+			mstdnServer = os.Getenv("MSTDN_SERVER")
+		}
+
+		if clientId == "" {
+			clientId = os.Getenv("MSTDN_CLIENT_ID")
+		}
+
+		if clientSecret == "" {
+			clientSecret = os.Getenv("MSTDN_CLIENT_SECRET")
+		}
+
+		if accessToken == "" {
+			accessToken = os.Getenv("MSTDN_ACCESS_TOKEN")
+		}
+
+		cfg.Sinks.Mastodon = &config.Mastodon{
+			Sink:         s,
+			Server:       mstdnServer,
+			ClientId:     config.Secret(clientId),
+			ClientSecret: config.Secret(clientSecret),
+			AccessToken:  config.Secret(accessToken),
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runSink(ctx, cfg, "mastodon")
+}
+
+// Bluesky はnamazu2blueskyの実装
+func Bluesky(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bluesky", flag.ExitOnError)
+
+	var c commonFlags
+	c.register(fs, "connect to namazu endpoint")
+
+	var pdsUrl string
+	fs.StringVar(&pdsUrl, "pds-host", "https://bsky.social", "method, hostname, and port of PDS instance")
+
+	var authFile string
+	fs.StringVar(&authFile, "auth-file", "bsky.auth", "path to JSON file with ATP auth info")
+
+	c.registerState(fs)
+
+	var s config.Sink
+	s.RegisterFlags(fs, sink.ReportsAll)
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {
+		if pdsUrl == "" {
+			pdsUrl = os.Getenv("ATP_PDS_HOST")
+		}
+
+		if authFile == "" {
+			authFile = os.Getenv("ATP_AUTH_FILE")
+		}
+
+		cfg.Sinks.Bluesky = &config.Bluesky{
+			Sink:     s,
+			PdsHost:  pdsUrl,
+			AuthFile: authFile,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runSink(ctx, cfg, "bluesky")
+}
+
+// Nostr はnamazu2nostrの実装
+func Nostr(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("nostr", flag.ExitOnError)
+
+	var c commonFlags
+
+	var nsec string
+	fs.StringVar(&nsec, "nsec", "", "nsec for nostr")
+
+	var imageServer string
+	fs.StringVar(&imageServer, "image-server", "", "NIP-96 server to upload map images")
+
+	c.register(fs, "zeromq endpoint")
+	c.registerState(fs)
+
+	var s config.Sink
+	s.RegisterFlags(fs, sink.ReportsFirstLast)
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {
+		if nsec == "" {
+			nsec = os.Getenv("NOSTR_SECRET_KEY")
+		}
+
+		cfg.Sinks.Nostr = &config.Nostr{
+			Sink:        s,
+			Nsec:        config.Secret(nsec),
+			ImageServer: imageServer,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runSink(ctx, cfg, "nostr")
+}
+
+// Mixi2 はnamazu2mixi2の実装
+func Mixi2(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mixi2", flag.ExitOnError)
+
+	var c commonFlags
+	c.register(fs, "connect to namazu endpoint")
+
+	var authKey string
+	fs.StringVar(&authKey, "auth-key", "", "auth key for mixi2")
+
+	var authToken string
+	fs.StringVar(&authToken, "auth-token", "", "auth token for mixi2")
+
+	var userAgent string
+	fs.StringVar(&userAgent, "user-agent", "", "User-Agent for mixi2")
+
+	c.registerState(fs)
+
+	var s config.Sink
+	s.RegisterFlags(fs, sink.ReportsFirstLast)
+
+	fs.Parse(args)
+
+	cfg, err := c.load(func(cfg *config.Config) {
+		if authKey == "" {
+			authKey = os.Getenv("MIXI2_AUTH_KEY")
+		}
+
+		if authToken == "" {
+			authToken = os.Getenv("MIXI2_AUTH_TOKEN")
+		}
+
+		if userAgent == "" {
+			userAgent = os.Getenv("MIXI2_USER_AGENT")
+		}
+
+		cfg.Sinks.Mixi2 = &config.Mixi2{
+			Sink:      s,
+			AuthKey:   config.Secret(authKey),
+			AuthToken: config.Secret(authToken),
+			UserAgent: userAgent,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runSink(ctx, cfg, "mixi2")
+}
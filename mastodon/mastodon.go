@@ -3,39 +3,22 @@ package mastodon
 import (
 	"bytes"
 	"context"
-	"sync"
-	"time"
 
-	"github.com/go-zeromq/zmq4"
 	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
 	"github.com/mattn/go-mastodon"
 	"golang.org/x/exp/slog"
 )
 
-const (
-	ZmqSubscribeType = "VXSE45"
-)
+// Limit は投稿できる文字数。インスタンスの既定値
+var Limit = eew.Limit{Max: 500, Count: eew.CountRunes}
 
-type Event struct {
-	XmlId     string
-	Serial    int
-	Message   string
-	MstdnId   mastodon.ID
-	ExpiresAt time.Time
+type Publisher struct {
+	c *mastodon.Client
 }
 
-func Run(ctx context.Context, zmqEndpoint, mstdnServer, clientId, clientSecret, accessToken string) error {
-	sub := zmq4.NewSub(ctx, zmq4.WithAutomaticReconnect(true))
-	defer sub.Close()
-	if err := sub.Dial(zmqEndpoint); err != nil {
-		slog.Error("Failed to dial zmq4 pubsub", err, slog.Any("zmq", zmqEndpoint))
-		return err
-	}
-	if err := sub.SetOption(zmq4.OptionSubscribe, ZmqSubscribeType); err != nil {
-		slog.Error("Failed to set option for subscribe", err)
-		return err
-	}
-
+func NewPublisher(ctx context.Context, mstdnServer, clientId, clientSecret, accessToken string) (*Publisher, error) {
 	c := mastodon.NewClient(&mastodon.Config{
 		Server:       mstdnServer,
 		ClientID:     clientId,
@@ -44,73 +27,94 @@ func Run(ctx context.Context, zmqEndpoint, mstdnServer, clientId, clientSecret,
 	})
 	u, err := c.GetAccountCurrentUser(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	slog.Info("Succeed to get account info", slog.Any("user", u))
+	return &Publisher{c: c}, nil
+}
 
-	var eventMap sync.Map
-	go func() {
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for now := range ticker.C {
-			eventMap.Range(func(k, v any) bool {
-				if v.(Event).ExpiresAt.After(now) {
-					eventMap.Delete(k)
-				}
-				return true
-			})
-		}
-	}()
+// upload は地図画像をアップロードしてtootに添付する。失敗しても画像なしで投稿する
+func (p *Publisher) upload(ctx context.Context, img *sink.Image, t *mastodon.Toot) {
+	if img == nil {
+		return
+	}
+	a, err := p.c.UploadMediaFromMedia(ctx, &mastodon.Media{
+		File:        bytes.NewReader(img.Data),
+		Description: img.Alt,
+	})
+	if err != nil {
+		slog.Error("Failed to upload media", err)
+		return
+	}
+	slog.Info("Succeed to upload media", slog.Any("id", a.ID))
+	t.MediaIDs = append(t.MediaIDs, a.ID)
+}
 
-	for {
-		msg, err := sub.Recv()
-		if err != nil {
-			slog.Error("Failed to receive from pubsub", err)
-			break
-		}
-		slog.Info("Succeed to receive from pubsub", slog.Any("msg", msg))
+func (p *Publisher) post(ctx context.Context, m sink.Message, t *mastodon.Toot) (sink.Ref, error) {
+	p.upload(ctx, m.Image, t)
+	s, err := p.c.PostStatus(ctx, t)
+	if err != nil {
+		slog.Error("Failed to toot", err, slog.Any("toot", t))
+		return sink.Ref{}, err
+	}
+	slog.Info("Succeed to post status", slog.Any("status", s), slog.Any("toot", t))
+	return sink.Ref{Id: string(s.ID)}, nil
+}
 
-		content, err := eew.NewContent(bytes.NewReader(msg.Frames[1]))
-		if err != nil {
-			slog.Error("Failed to parse xml", err)
+// 初報は公開
+func (p *Publisher) Post(ctx context.Context, m sink.Message) (sink.Ref, error) {
+	return p.post(ctx, m, &mastodon.Toot{
+		Status:     m.Text,
+		Language:   string(m.Language),
+		Visibility: mastodon.VisibilityPublic,
+	})
+}
+
+// 続報は未収載
+func (p *Publisher) Reply(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	return p.post(ctx, m, &mastodon.Toot{
+		Status:      m.Text,
+		Language:    string(m.Language),
+		Visibility:  mastodon.VisibilityUnlisted,
+		InReplyToID: mastodon.ID(t.Last.Id),
+	})
+}
+
+// Retract はスレッドに取消を投稿し、最初の投稿と返信先を残してこれまでの投稿を削除する
+func (p *Publisher) Retract(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	ref, err := p.post(ctx, m, &mastodon.Toot{
+		Status:      m.Text,
+		Language:    string(m.Language),
+		Visibility:  mastodon.VisibilityPublic,
+		InReplyToID: mastodon.ID(t.Last.Id),
+	})
+	if err != nil {
+		return ref, err
+	}
+	for _, post := range t.Deletable() {
+		if err := p.c.DeleteStatus(ctx, mastodon.ID(post.Id)); err != nil {
+			// 削除に失敗しても取消自体は投稿済みなので続ける
+			slog.Error("Failed to delete status", err, slog.Any("id", post.Id))
 			continue
 		}
-		ev := Event{
-			XmlId:   content.EventId,
-			Serial:  int(content.Serial),
-			Message: content.String(),
-		}
-		t := mastodon.Toot{
-			Status:   ev.Message,
-			Language: "ja",
-		}
-		if v, ok := eventMap.Load(ev.XmlId); ok {
-			prev := v.(Event)
-			// 過去報もしくは同じものが届いた場合はスキップ
-			if ev.Serial <= prev.Serial {
-				slog.Info("Skip old serial", slog.Any("now", ev), slog.Any("prev", prev))
-				continue
-			}
-			if prev.MstdnId == "" {
-				// 空になっているのはおかしいので警告
-				slog.Warn("Failed to get MstdnId", slog.Any("event", ev))
-			} else {
-				t.InReplyToID = prev.MstdnId
-			}
-			// 初報は公開、それ以外は未収載
-			t.Visibility = mastodon.VisibilityUnlisted
-		} else {
-			t.Visibility = mastodon.VisibilityPublic
-		}
+		slog.Info("Succeed to delete status", slog.Any("id", post.Id))
+	}
+	return ref, nil
+}
 
-		s, err := c.PostStatus(ctx, &t)
-		if err != nil {
-			slog.Error("Failed to toot", err, slog.Any("toot", t))
-			return err
-		}
-		slog.Info("Succeed to post status", slog.Any("status", s), slog.Any("toot", t))
-		ev.MstdnId = s.ID
-		eventMap.Store(ev.XmlId, ev)
+func Run(ctx context.Context, src sink.Source, mstdnServer, clientId, clientSecret, accessToken string, training sink.TrainingMode, policy sink.Policy, renderers []*eew.Renderer, attachMap bool, store state.Store) error {
+	p, err := NewPublisher(ctx, mstdnServer, clientId, clientSecret, accessToken)
+	if err != nil {
+		return err
+	}
+	r := sink.Runner{
+		Name:      "mastodon",
+		Publisher: p,
+		Store:     store,
+		Training:  training,
+		Policy:    policy,
+		Renderers: renderers,
+		Map:       attachMap,
 	}
-	return nil
+	return r.Run(ctx, src)
 }
@@ -1,107 +1,68 @@
 package mixi2
 
 import (
-	"bytes"
 	"context"
-	"sync"
-	"time"
 
 	"connectrpc.com/connect"
-	"github.com/go-zeromq/zmq4"
 	"github.com/matsuu/go-mixi2"
 	"github.com/matsuu/go-mixi2/gen/com/mixi/mercury/api"
 	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
 	"golang.org/x/exp/slog"
 )
 
-const (
-	ZmqSubscribeType = "VXSE45"
-)
+// Limit は投稿できる文字数
+var Limit = eew.Limit{Max: 149, Count: eew.CountRunes}
 
-type Event struct {
-	XmlId     string
-	Serial    int
-	Message   string
-	ExpiresAt time.Time
-	PostId    string
+// 使っているgo-mixi2には画像をアップロードするAPIがないため、地図画像は添付しない
+type Publisher struct {
+	c *mixi2.Client
 }
 
-func Run(ctx context.Context, zmqEndpoint, authKey, authToken, userAgent string) error {
-	sub := zmq4.NewSub(ctx, zmq4.WithAutomaticReconnect(true))
-	defer sub.Close()
-	if err := sub.Dial(zmqEndpoint); err != nil {
-		slog.Error("Failed to dial zmq4 pubsub", err, slog.Any("zmq", zmqEndpoint))
-		return err
-	}
-	if err := sub.SetOption(zmq4.OptionSubscribe, ZmqSubscribeType); err != nil {
-		slog.Error("Failed to set option for subscribe", err)
-		return err
+func NewPublisher(authKey, authToken, userAgent string) *Publisher {
+	return &Publisher{
+		c: mixi2.NewClient(mixi2.WithAuth(authKey, authToken, userAgent)),
 	}
+}
 
-	c := mixi2.NewClient(mixi2.WithAuth(authKey, authToken, userAgent))
+func (p *Publisher) createPost(ctx context.Context, post *api.CreatePostRequest) (sink.Ref, error) {
+	resp, err := p.c.CreatePost(ctx, connect.NewRequest(post))
+	if err != nil {
+		slog.Error("failed to create post", err, slog.Any("post", post))
+		return sink.Ref{}, err
+	}
+	slog.Info("Succeed to post status", slog.Any("resp", resp), slog.Any("post", post))
+	return sink.Ref{Id: resp.Msg.Post.PostId}, nil
+}
 
-	var eventMap sync.Map
-	go func() {
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for now := range ticker.C {
-			eventMap.Range(func(k, v any) bool {
-				if v.(Event).ExpiresAt.Before(now) {
-					eventMap.Delete(k)
-				}
-				return true
-			})
-		}
-	}()
+func (p *Publisher) Post(ctx context.Context, m sink.Message) (sink.Ref, error) {
+	return p.createPost(ctx, &api.CreatePostRequest{
+		Text: m.Text,
+	})
+}
 
-	for {
-		msg, err := sub.Recv()
-		if err != nil {
-			slog.Error("Failed to receive from pubsub", err)
-			break
-		}
-		slog.Info("Succeed to receive from pubsub", slog.Any("msg", msg))
+func (p *Publisher) Reply(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	replyTo := t.Last.Id
+	return p.createPost(ctx, &api.CreatePostRequest{
+		Text:    m.Text,
+		ReplyTo: &replyTo,
+	})
+}
 
-		content, err := eew.NewContent(bytes.NewReader(msg.Frames[1]))
-		if err != nil {
-			slog.Error("Failed to parse xml", err)
-			continue
-		}
-		ev := Event{
-			XmlId:   content.EventId,
-			Serial:  int(content.Serial),
-			Message: content.String(),
-		}
+// 投稿の削除はAPIがないためスレッドへの返信で取消を伝える
+func (p *Publisher) Retract(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	return p.Reply(ctx, m, t)
+}
 
-		post := &api.CreatePostRequest{
-			Text: ev.Message,
-		}
-		if v, ok := eventMap.Load(ev.XmlId); ok {
-			prev := v.(Event)
-			// 過去報もしくは同じものが届いた場合はスキップ
-			if ev.Serial <= prev.Serial {
-				slog.Info("skip old serial", slog.Any("now", ev), slog.Any("prev", prev))
-				continue
-			}
-			// 続きは最終報のみpostする
-			if !content.IsLast {
-				continue
-			}
-			if prev.PostId == "" {
-				// 空になっているのはおかしいので警告
-				slog.Warn("Failed to get PostId", slog.Any("event", ev))
-			} else {
-				post.ReplyTo = &prev.PostId
-			}
-		}
-		resp, err := c.CreatePost(ctx, connect.NewRequest(post))
-		if err != nil {
-			slog.Error("failed to create post", err, slog.Any("post", post))
-			return err
-		}
-		slog.Info("Succeed to post status", slog.Any("resp", resp), slog.Any("post", post))
-		ev.PostId = resp.Msg.Post.PostId
-		eventMap.Store(ev.XmlId, ev)
+func Run(ctx context.Context, src sink.Source, authKey, authToken, userAgent string, training sink.TrainingMode, policy sink.Policy, renderers []*eew.Renderer, store state.Store) error {
+	r := sink.Runner{
+		Name:      "mixi2",
+		Publisher: NewPublisher(authKey, authToken, userAgent),
+		Store:     store,
+		Training:  training,
+		Policy:    policy,
+		Renderers: renderers,
 	}
-	return nil
+	return r.Run(ctx, src)
 }
@@ -0,0 +1,502 @@
+// Package mockdmdata はDMDATA.JPのSocket API v2を模したサーバ
+//
+// 手元のXMLやJSONの電文をWebSocketで流すので、APIキーやネットワークなしでnamazu全体を試せる
+package mockdmdata
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matsuu/namazu/eew"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/websocket"
+)
+
+const protocol = "dmdata.v2"
+
+// Options はmockの挙動
+type Options struct {
+	// 空ならAPIキーを検査しない
+	ApiKey string
+	// 送信する電文。この順に送る。拡張子が.jsonならJSON形式として送る
+	Files []string
+	// startから最初の電文までの待ち時間
+	Delay time.Duration
+	// 電文の送信間隔
+	Interval time.Duration
+	// pingの送信間隔
+	PingInterval time.Duration
+	// base64, utf-8
+	Encoding string
+	// gzip, zip, 空なら圧縮しない
+	Compression string
+	// 最後まで送ったら最初から繰り返す
+	Loop bool
+	// head.testの値
+	Test bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Delay:        time.Second,
+		Interval:     3 * time.Second,
+		PingInterval: 30 * time.Second,
+		Encoding:     "base64",
+		Compression:  "gzip",
+	}
+}
+
+type telegram struct {
+	typ string
+	// 拡張子を除いたパス。同じ電文のXMLとJSONで共通
+	name string
+	// xml, json
+	format string
+	body   []byte
+}
+
+type socket struct {
+	id     int
+	ticket string
+	// 要求された区分
+	classifications []string
+	// raw, json
+	formatMode string
+	// DELETEされたら閉じる
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *socket) close() {
+	s.once.Do(func() { close(s.closed) })
+}
+
+// Server はPOST/DELETE /v2/socketとWebSocketを提供する
+type Server struct {
+	opts      Options
+	telegrams []telegram
+	// JSON形式もある電文のname
+	hasJSON map[string]bool
+
+	mu      sync.Mutex
+	nextId  int
+	sockets map[int]*socket
+	tickets map[string]*socket
+}
+
+// ファイル名に含まれる電文種別コード
+var reType = regexp.MustCompile(`[A-Z]{4}\d{2}`)
+
+func NewServer(opts Options) (*Server, error) {
+	switch opts.Encoding {
+	case "base64":
+	case "utf-8":
+		if opts.Compression != "" {
+			return nil, fmt.Errorf("compressed body must be base64")
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", opts.Encoding)
+	}
+	switch opts.Compression {
+	case "", "gzip", "zip":
+	default:
+		return nil, fmt.Errorf("unknown compression: %s", opts.Compression)
+	}
+
+	var telegrams []telegram
+	hasJSON := make(map[string]bool)
+	for _, f := range opts.Files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		typ := reType.FindString(filepath.Base(f))
+		if typ == "" {
+			typ = "VXSE45"
+		}
+		name := strings.TrimSuffix(f, filepath.Ext(f))
+		format := "xml"
+		if filepath.Ext(f) == ".json" {
+			format = "json"
+			hasJSON[name] = true
+		}
+		telegrams = append(telegrams, telegram{typ: typ, name: name, format: format, body: b})
+	}
+	if len(telegrams) == 0 {
+		return nil, fmt.Errorf("no telegram files")
+	}
+
+	return &Server{
+		opts:      opts,
+		telegrams: telegrams,
+		hasJSON:   hasJSON,
+		nextId:    1,
+		sockets:   make(map[int]*socket),
+		tickets:   make(map[string]*socket),
+	}, nil
+}
+
+// ExpandFiles はディレクトリ内の*.xmlと*.jsonを名前順に展開する
+func ExpandFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		var m []string
+		for _, ext := range []string{"*.xml", "*.json"} {
+			g, err := filepath.Glob(filepath.Join(p, ext))
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, g...)
+		}
+		sort.Strings(m)
+		files = append(files, m...)
+	}
+	return files, nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v2/socket", s.openSocket)
+	mux.HandleFunc("DELETE /v2/socket/{id}", s.closeSocket)
+	mux.Handle("GET /v2/websocket", websocket.Server{
+		Handshake: s.handshake,
+		Handler:   s.serveWebsocket,
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", err)
+	}
+}
+
+func status(s string) eew.SocketResponseStatus {
+	return eew.SocketResponseStatus{
+		ResponseId:   newId(),
+		ResponseTime: time.Now(),
+		Status:       s,
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	var e eew.SocketResponseError
+	e.SocketResponseStatus = status("error")
+	e.Error.Code = code
+	e.Error.Message = message
+	writeJSON(w, code, e)
+}
+
+func newId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	return s.opts.ApiKey == "" || r.URL.Query().Get("key") == s.opts.ApiKey
+}
+
+func (s *Server) openSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Authentication failed.")
+		return
+	}
+	var sreq eew.SocketRequest
+	if err := json.NewDecoder(r.Body).Decode(&sreq); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body.")
+		return
+	}
+	formatMode := sreq.FormatMode
+	switch formatMode {
+	case "":
+		formatMode = "raw"
+	case "raw", "json":
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid formatMode.")
+		return
+	}
+
+	s.mu.Lock()
+	sock := &socket{
+		id:              s.nextId,
+		ticket:          newId(),
+		classifications: sreq.Classifications,
+		formatMode:      formatMode,
+		closed:          make(chan struct{}),
+	}
+	s.nextId++
+	s.sockets[sock.id] = sock
+	s.tickets[sock.ticket] = sock
+	s.mu.Unlock()
+
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	var sres eew.SocketResponse
+	sres.SocketResponseStatus = status("ok")
+	sres.Ticket = sock.ticket
+	sres.Websocket.Id = sock.id
+	sres.Websocket.Url = fmt.Sprintf("%s://%s/v2/websocket?ticket=%s", scheme, r.Host, sock.ticket)
+	sres.Websocket.Protocol = []string{protocol}
+	sres.Websocket.Expiration = 300
+	sres.Classifications = sreq.Classifications
+	sres.Test = sreq.Test
+	sres.Types = sreq.Types
+	sres.Formats = formats(formatMode)
+	slog.Info("Succeed to open socket", slog.Any("id", sock.id))
+	writeJSON(w, http.StatusOK, sres)
+}
+
+func (s *Server) closeSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Authentication failed.")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid socket id.")
+		return
+	}
+	s.mu.Lock()
+	sock, ok := s.sockets[id]
+	delete(s.sockets, id)
+	if ok {
+		delete(s.tickets, sock.ticket)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Socket not found.")
+		return
+	}
+	sock.close()
+	slog.Info("Succeed to close socket", slog.Any("id", id))
+	writeJSON(w, http.StatusOK, status("ok"))
+}
+
+// Sockets は開いているsocketの数
+func (s *Server) Sockets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sockets)
+}
+
+func (s *Server) handshake(config *websocket.Config, r *http.Request) error {
+	s.mu.Lock()
+	_, ok := s.tickets[r.URL.Query().Get("ticket")]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("invalid ticket")
+	}
+	for _, p := range config.Protocol {
+		if p == protocol {
+			config.Protocol = []string{protocol}
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported protocol: %v", config.Protocol)
+}
+
+// take はticketに対応するsocketを返す。ticketは1回だけ使える
+func (s *Server) take(ticket string) *socket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sock := s.tickets[ticket]
+	delete(s.tickets, ticket)
+	return sock
+}
+
+func (s *Server) serveWebsocket(ws *websocket.Conn) {
+	defer ws.Close()
+	sock := s.take(ws.Request().URL.Query().Get("ticket"))
+	if sock == nil {
+		return
+	}
+
+	var start eew.WebsocketStart
+	start.Type = "start"
+	start.SocketId = sock.id
+	start.Classifications = sock.classifications
+	start.Test = "including"
+	start.Formats = formats(sock.formatMode)
+	start.Time = time.Now()
+	if err := websocket.JSON.Send(ws, start); err != nil {
+		slog.Error("Failed to send start message", err)
+		return
+	}
+
+	// pongを読み捨てる。切断されたら終了する
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			var b []byte
+			if err := websocket.Message.Receive(ws, &b); err != nil {
+				return
+			}
+			slog.Debug("Received message", slog.Any("message", string(b)))
+		}
+	}()
+
+	// 要求された区分と形式の電文だけを送る
+	var telegrams []telegram
+	for _, t := range s.telegrams {
+		if slices.Contains(sock.classifications, eew.ClassificationOf(t.typ)) && s.wants(sock.formatMode, t) {
+			telegrams = append(telegrams, t)
+		}
+	}
+
+	ping := time.NewTicker(s.opts.PingInterval)
+	defer ping.Stop()
+	next := time.NewTimer(s.opts.Delay)
+	defer next.Stop()
+	if len(telegrams) == 0 {
+		next.Stop()
+	}
+
+	i := 0
+	for {
+		select {
+		case <-disconnected:
+			slog.Info("Disconnected", slog.Any("id", sock.id))
+			return
+		case <-sock.closed:
+			var e eew.WebsocketError
+			e.Type = "error"
+			e.Error = "The socket has been closed."
+			e.Code = 4808
+			e.Close = true
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				slog.Error("Failed to send error message", err)
+			}
+			return
+		case <-ping.C:
+			var p eew.WebsocketPing
+			p.Type = "ping"
+			p.PingId = newId()
+			if err := websocket.JSON.Send(ws, p); err != nil {
+				slog.Error("Failed to send ping message", err)
+				return
+			}
+		case <-next.C:
+			data, err := s.data(telegrams[i])
+			if err != nil {
+				slog.Error("Failed to encode telegram", err)
+				return
+			}
+			if err := websocket.JSON.Send(ws, data); err != nil {
+				slog.Error("Failed to send data message", err)
+				return
+			}
+			slog.Info("Succeed to send data", slog.Any("id", sock.id), slog.Any("type", data.Head.Type), slog.Any("no", i))
+			i++
+			if i == len(telegrams) {
+				if !s.opts.Loop {
+					continue
+				}
+				i = 0
+			}
+			next.Reset(s.opts.Interval)
+		}
+	}
+}
+
+// formats はformatModeで届く電文の形式
+func formats(formatMode string) []string {
+	if formatMode == "json" {
+		return []string{"xml", "json"}
+	}
+	return []string{"xml"}
+}
+
+// wants はformatModeでtを送るかどうか。jsonならJSON形式のある電文はJSONだけを送る
+func (s *Server) wants(formatMode string, t telegram) bool {
+	if formatMode == "json" {
+		return t.format == "json" || !s.hasJSON[t.name]
+	}
+	return t.format == "xml"
+}
+
+func (s *Server) data(t telegram) (*eew.WebsocketData, error) {
+	body := t.body
+	switch s.opts.Compression {
+	case "gzip":
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	case "zip":
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(t.typ + "." + t.format)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+
+	var d eew.WebsocketData
+	d.Type = "data"
+	d.Version = "2.0"
+	sum := sha256.Sum256(t.body)
+	d.Id = hex.EncodeToString(sum[:])
+	d.Classification = eew.ClassificationOf(t.typ)
+	d.Head.Type = t.typ
+	d.Head.Author = "気象庁"
+	d.Head.Time = time.Now()
+	d.Head.Test = s.opts.Test
+	d.Head.Xml = t.format == "xml"
+	format := t.format
+	d.Format = &format
+	encoding := s.opts.Encoding
+	d.Encoding = &encoding
+	if s.opts.Compression != "" {
+		compression := s.opts.Compression
+		d.Compression = &compression
+	}
+	if encoding == "base64" {
+		d.Body = base64.StdEncoding.EncodeToString(body)
+	} else {
+		d.Body = string(body)
+	}
+	return &d, nil
+}
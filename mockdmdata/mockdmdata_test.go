@@ -0,0 +1,175 @@
+package mockdmdata
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+func TestServer(t *testing.T) {
+	files, err := ExpandFiles([]string{"../eew/samples"})
+	if err != nil {
+		t.Fatalf("failed to expand files: %v", err)
+	}
+
+	jsonFiles := []string{
+		"../eew/samples/77_01_01_110311_VXSE43.json",
+		"../eew/samples/77_01_01_110311_VXSE45.json",
+		"../eew/samples/77_01_02_110311_VXSE45.json",
+	}
+	// rawではXMLだけ、jsonではJSON形式のある電文はJSONだけが届く
+	var xmlFiles, preferJSON []string
+	for _, f := range files {
+		if filepath.Ext(f) == ".xml" {
+			xmlFiles = append(xmlFiles, f)
+		}
+		if filepath.Ext(f) == ".json" || !slices.Contains(files, strings.TrimSuffix(f, ".xml")+".json") {
+			preferJSON = append(preferJSON, f)
+		}
+	}
+	// 予報のみ要求した場合は警報や地震情報が届かない
+	var forecastFiles []string
+	for _, f := range xmlFiles {
+		if eew.ClassificationOf(reType.FindString(f)) == eew.ClassificationForecast {
+			forecastFiles = append(forecastFiles, f)
+		}
+	}
+	all := []string{eew.ClassificationForecast, eew.ClassificationWarning, eew.ClassificationEarthquake}
+
+	tests := []struct {
+		name            string
+		encoding        string
+		compression     string
+		classifications []string
+		format          string
+		files           []string
+		want            []string
+	}{
+		{"gzip", "base64", "gzip", all, "xml", files, xmlFiles},
+		{"zip", "base64", "zip", all, "xml", files, xmlFiles},
+		{"base64", "base64", "", all, "xml", files, xmlFiles},
+		{"utf-8", "utf-8", "", all, "xml", files, xmlFiles},
+		{"json", "base64", "gzip", all, "json", jsonFiles, jsonFiles},
+		{"json zip", "base64", "zip", all, "json", files, preferJSON},
+		{"forecast", "base64", "gzip", []string{eew.ClassificationForecast}, "xml", files, forecastFiles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ApiKey = "key"
+			opts.Files = tt.files
+			opts.Delay = 0
+			opts.Interval = 10 * time.Millisecond
+			opts.Encoding = tt.encoding
+			opts.Compression = tt.compression
+			s, err := NewServer(opts)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			ts := httptest.NewServer(s.Handler())
+			defer ts.Close()
+
+			bus := eew.NewBus()
+			sub := bus.Subscribe("VXSE", "VTSE")
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- eew.NewClient("key", eew.WithApiBase(ts.URL), eew.WithClassifications(tt.classifications...), eew.WithFormat(tt.format)).Run(ctx, bus)
+			}()
+
+			for _, f := range tt.want {
+				want, _ := os.ReadFile(f)
+				got, err := sub.Recv()
+				if err != nil {
+					t.Fatalf("failed to recv: %v", err)
+				}
+				if want := reType.FindString(f); got.Type != want {
+					t.Errorf("type got:%s want:%s", got.Type, want)
+				}
+				if !bytes.Equal(got.Body, want) {
+					t.Errorf("body of %s is not equal", f)
+				}
+			}
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("failed to run client: %v", err)
+			}
+			if got := s.Sockets(); got != 0 {
+				t.Errorf("sockets got:%d want:0", got)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ApiKey = "key"
+	opts.Files = []string{"../eew/samples/77_01_01_110311_VXSE45.xml"}
+	s, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	res, err := ts.Client().Post(ts.URL+"/v2/socket?key=wrong", "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	defer res.Body.Close()
+	if _, err := eew.ParseSocketResponse(res.Body); err == nil {
+		t.Errorf("no error for wrong key")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Files = []string{"../eew/samples/77_01_01_110311_VXSE45.xml"}
+	s, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		formatMode string
+		want       []string
+	}{
+		{"", []string{"xml"}},
+		{"raw", []string{"xml"}},
+		{"json", []string{"xml", "json"}},
+		{"binary", nil},
+	}
+	for _, tt := range tests {
+		req := fmt.Sprintf(`{"classifications":["eew.forecast"],"formatMode":%q}`, tt.formatMode)
+		res, err := ts.Client().Post(ts.URL+"/v2/socket", "application/json", strings.NewReader(req))
+		if err != nil {
+			t.Fatalf("failed to post: %v", err)
+		}
+		sres, err := eew.ParseSocketResponse(res.Body)
+		res.Body.Close()
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: no error for unknown formatMode", tt.formatMode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: failed to open socket: %v", tt.formatMode, err)
+		}
+		if !slices.Equal(sres.Formats, tt.want) {
+			t.Errorf("%q: got:%v want:%v", tt.formatMode, sres.Formats, tt.want)
+		}
+	}
+}
@@ -1,22 +1,21 @@
 package nostr
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"sync"
+	"net/http"
 	"time"
 
-	"github.com/go-zeromq/zmq4"
 	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/sink"
+	"github.com/matsuu/namazu/state"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
 	"golang.org/x/exp/slog"
 )
 
-const (
-	ZmqSubscribeType = "VXSE45"
-)
+// Limit は投稿できる文字数。nostrには上限がない
+var Limit = eew.Limit{}
 
 var defaultRelays = []string{
 	// "ws://127.0.0.1:7001",
@@ -33,15 +32,6 @@ var defaultRelays = []string{
 	"wss://relay.damus.io",
 }
 
-type Event struct {
-	XmlId     string
-	Serial    int
-	Message   string
-	NostrId   string
-	RootId    string
-	ExpiresAt time.Time
-}
-
 func getRelays(ctx context.Context, npub string) ([]string, error) {
 
 	var relay *nostr.Relay
@@ -118,11 +108,20 @@ E:
 	return relays, nil
 }
 
-func Run(ctx context.Context, nsec, zmqEndpoint string) error {
+type Publisher struct {
+	sk       string
+	pub      string
+	chRelays []chan<- nostr.Event
+	// 地図画像のアップロード先。nilなら添付しない
+	uploader *uploader
+}
+
+// NewPublisher はnsecで署名して投稿するPublisherを作る。imageServerが空でなければ地図画像をNIP-96でアップロードする
+func NewPublisher(ctx context.Context, nsec, imageServer string) (*Publisher, error) {
 	var sk string
 	if nsec != "" {
 		if _, s, err := nip19.Decode(nsec); err != nil {
-			return err
+			return nil, err
 		} else {
 			sk = s.(string)
 		}
@@ -130,132 +129,117 @@ func Run(ctx context.Context, nsec, zmqEndpoint string) error {
 		sk = nostr.GeneratePrivateKey()
 		slog.Warn("no secret key. Generated", slog.Any("sec", sk))
 	}
-
-	sub := zmq4.NewSub(ctx, zmq4.WithAutomaticReconnect(true), zmq4.WithID(zmq4.SocketIdentity("nostr")))
-	defer sub.Close()
-	if err := sub.Dial(zmqEndpoint); err != nil {
-		slog.Error("Failed to dial zmq namazu", err)
-		return err
-	}
-	if err := sub.SetOption(zmq4.OptionSubscribe, ZmqSubscribeType); err != nil {
-		slog.Error("Failed to set option for zmq namazu", err)
-		return err
+	pub, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return nil, err
 	}
-	slog.Info("Succeed to dial zmq namazu", slog.Any("endpoint", zmqEndpoint))
 
 	chRelays, err := relayWorker(ctx, sk)
 	if err != nil {
 		slog.Error("Failed to run relayWorker", err)
-		return err
+		return nil, err
 	}
-
-	if err := eventWorker(ctx, sub, chRelays, sk); err != nil {
-		slog.Error("Failed to run eventWorker", err)
+	p := &Publisher{
+		sk:       sk,
+		pub:      pub,
+		chRelays: chRelays,
 	}
-
-	return nil
+	if imageServer != "" {
+		p.uploader = &uploader{server: imageServer, sk: sk, pub: pub, client: http.DefaultClient}
+	}
+	return p, nil
 }
 
-func eventWorker(ctx context.Context, sub zmq4.Socket, chRelays []chan<- nostr.Event, sk string) error {
-	pub, err := nostr.GetPublicKey(sk)
-	if err != nil {
-		return err
+func (p *Publisher) publish(kind int, tags nostr.Tags, content string) sink.Ref {
+	e := nostr.Event{
+		PubKey:    p.pub,
+		CreatedAt: nostr.Now(),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
 	}
+	e.Sign(p.sk)
+	broadcast(p.chRelays, e)
+	// EventIDはreplyに使われるので記録しておく
+	return sink.Ref{Id: e.ID}
+}
 
-	var eventMap sync.Map
-	go func() {
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for now := range ticker.C {
-			eventMap.Range(func(k, v any) bool {
-				if v.(Event).ExpiresAt.After(now) {
-					eventMap.Delete(k)
-				}
-				return true
-			})
-		}
-	}()
+// languageTags はNIP-32で投稿文の言語を示す
+func languageTags(m sink.Message) nostr.Tags {
+	if m.Language == "" {
+		return nil
+	}
+	return nostr.Tags{{"L", "ISO-639-1"}, {"l", string(m.Language), "ISO-639-1"}}
+}
 
-	for {
-		slog.Info("Wait receive from pubsub")
-		msg, err := sub.Recv()
-		if err != nil {
-			slog.Error("Failed to receive from pubsub", err)
-			return err
-		}
-		slog.Info("Succeed to receive from pubsub", slog.Any("msg", msg))
+func (p *Publisher) Post(ctx context.Context, m sink.Message) (sink.Ref, error) {
+	content, tags := p.attach(ctx, m, languageTags(m))
+	return p.publish(1, tags, content), nil
+}
 
-		content, err := eew.NewContent(bytes.NewReader(msg.Frames[1]))
-		if err != nil {
-			slog.Error("Failed to parse xml", err)
-			return err
-		}
-		ev := Event{
-			XmlId:   content.EventId,
-			Serial:  int(content.Serial),
-			Message: content.String(),
-		}
+func (p *Publisher) Reply(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	tags := nostr.Tags{{"e", t.Root.Id, "", "root"}}
+	// 1つ前のがrootと異なるならreplyとして追加
+	if t.Last.Id != t.Root.Id {
+		tags = append(tags, nostr.Tag{"e", t.Last.Id, "", "reply"})
+	}
+	// rootもreplyも自分自身
+	tags = append(tags, nostr.Tag{"p", p.pub})
+	tags = append(tags, languageTags(m)...)
+	content, tags := p.attach(ctx, m, tags)
+	return p.publish(1, tags, content), nil
+}
 
+// Retract はスレッドに取消を投稿し、NIP-09で最初の投稿と返信先を除くこれまでの投稿の削除を要求する
+func (p *Publisher) Retract(ctx context.Context, m sink.Message, t *sink.Thread) (sink.Ref, error) {
+	ref, err := p.Reply(ctx, m, t)
+	if err != nil {
+		return ref, err
+	}
+	if posts := t.Deletable(); len(posts) > 0 {
 		var tags nostr.Tags
-		if v, ok := eventMap.Load(ev.XmlId); ok {
-			prev := v.(Event)
-			// 過去報もしくは同じものが届いた場合はスキップ
-			if ev.Serial <= prev.Serial {
-				slog.Info("Skip old serial", slog.Any("now", ev), slog.Any("prev", prev))
-				continue
-			}
-			// 続きは最終報のみpostする
-			if !content.IsLast {
-				continue
-			}
-			if prev.RootId == "" {
-				// 空になっているのはおかしいので警告
-				slog.Warn("Failed to get RootId", slog.Any("event", ev))
-			} else {
-				// rootイベントは引き継ぐ
-				ev.RootId = prev.RootId
-				tag := nostr.Tag{"e", ev.RootId, "", "root"}
-				tags = append(tags, tag)
-				// 1つ前のがrootと異なるならreplyとして追加
-				if prev.RootId != prev.NostrId {
-					tag := nostr.Tag{"e", prev.NostrId, "", "reply"}
-					tags = append(tags, tag)
-				}
-				// rootもreplyも自分自身
-				tag = nostr.Tag{"p", pub}
-				tags = append(tags, tag)
-			}
+		for _, post := range posts {
+			tags = append(tags, nostr.Tag{"e", post.Id})
 		}
-		e := nostr.Event{
-			PubKey:    pub,
-			CreatedAt: nostr.Now(),
-			Kind:      1,
-			Tags:      tags,
-			Content:   ev.Message,
-		}
-		e.Sign(sk)
+		// 削除の理由は取消の投稿文と同じにする
+		p.publish(5, tags, m.Text)
+	}
+	return ref, nil
+}
 
-		failedCount := 0
-		for i, ch := range chRelays {
-			// 詰まっている場合はスキップ
-			select {
-			case ch <- e:
-				slog.Info("Succeed to send events to channel", slog.Any("no", i))
-			default:
-				failedCount++
-				slog.Warn("Failed to send events to channel", slog.Any("no", i))
-			}
-		}
-		slog.Info("Succeed to send events to channels", slog.Any("event", e), slog.Any("totalCount", len(chRelays)), slog.Any("failedCount", failedCount))
+func Run(ctx context.Context, src sink.Source, nsec, imageServer string, training sink.TrainingMode, policy sink.Policy, renderers []*eew.Renderer, attachMap bool, store state.Store) error {
+	p, err := NewPublisher(ctx, nsec, imageServer)
+	if err != nil {
+		return err
+	}
+	r := sink.Runner{
+		Name:      "nostr",
+		Publisher: p,
+		Store:     store,
+		Training:  training,
+		Policy:    policy,
+		Renderers: renderers,
+		Map:       attachMap,
+	}
+	if err := r.Run(ctx, src); err != nil {
+		slog.Error("Failed to run sink", err)
+	}
+	return nil
+}
 
-		// EventIDはreplyに使われるので記録しておく
-		ev.NostrId = e.ID
-		// rootが設定されていなければ自分がrootになる
-		if ev.RootId == "" {
-			ev.RootId = e.ID
+func broadcast(chRelays []chan<- nostr.Event, e nostr.Event) {
+	failedCount := 0
+	for i, ch := range chRelays {
+		// 詰まっている場合はスキップ
+		select {
+		case ch <- e:
+			slog.Info("Succeed to send events to channel", slog.Any("no", i))
+		default:
+			failedCount++
+			slog.Warn("Failed to send events to channel", slog.Any("no", i))
 		}
-		eventMap.Store(ev.XmlId, ev)
 	}
+	slog.Info("Succeed to send events to channels", slog.Any("event", e), slog.Any("totalCount", len(chRelays)), slog.Any("failedCount", failedCount))
 }
 
 func relayWorker(ctx context.Context, sk string) ([]chan<- nostr.Event, error) {
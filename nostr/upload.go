@@ -0,0 +1,205 @@
+package nostr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/matsuu/namazu/shakemap"
+	"github.com/matsuu/namazu/sink"
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/exp/slog"
+)
+
+// kindHttpAuth はNIP-98の認証に使うイベントの種類
+const kindHttpAuth = 27235
+
+// uploader はNIP-96のサーバーへ画像をアップロードする
+type uploader struct {
+	server string
+	sk     string
+	pub    string
+	client *http.Client
+
+	mu sync.Mutex
+	// .well-known/nostr/nip96.jsonから得たアップロード先。空なら未取得
+	apiUrl string
+}
+
+// api はアップロード先のURLを返す。初回のみサーバーに問い合わせる
+func (u *uploader) api(ctx context.Context) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.apiUrl != "" {
+		return u.apiUrl, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(u.server, "/")+"/.well-known/nostr/nip96.json", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status of nip96.json: %s", resp.Status)
+	}
+	var info struct {
+		ApiUrl string `json:"api_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	if info.ApiUrl == "" {
+		return "", fmt.Errorf("no api_url in nip96.json")
+	}
+	u.apiUrl = info.ApiUrl
+	return u.apiUrl, nil
+}
+
+// authorization はNIP-98のAuthorizationヘッダーを作る
+func (u *uploader) authorization(url, method string, body []byte) (string, error) {
+	sum := sha256.Sum256(body)
+	e := nostr.Event{
+		PubKey:    u.pub,
+		CreatedAt: nostr.Now(),
+		Kind:      kindHttpAuth,
+		Tags: nostr.Tags{
+			{"u", url},
+			{"method", method},
+			{"payload", hex.EncodeToString(sum[:])},
+		},
+	}
+	if err := e.Sign(u.sk); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return "Nostr " + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// upload はimgをアップロードしてNIP-94のタグを返す
+func (u *uploader) upload(ctx context.Context, img *sink.Image) (nostr.Tags, error) {
+	url, err := u.api(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, field := range [][2]string{{"alt", img.Alt}, {"content_type", img.MimeType}} {
+		if err := w.WriteField(field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+	f, err := w.CreateFormFile("file", "map.png")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(img.Data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	auth, err := u.authorization(url, http.MethodPost, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", auth)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// 処理待ちの202は扱わない
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected status of upload: %s: %s", resp.Status, b)
+	}
+	var out struct {
+		Status     string `json:"status"`
+		Message    string `json:"message"`
+		Nip94Event struct {
+			Tags nostr.Tags `json:"tags"`
+		} `json:"nip94_event"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	if out.Status != "success" {
+		return nil, fmt.Errorf("failed to upload: %s", out.Message)
+	}
+	if value(out.Nip94Event.Tags, "url") == "" {
+		return nil, fmt.Errorf("no url in nip94_event")
+	}
+	return out.Nip94Event.Tags, nil
+}
+
+// value はtagsのうち名前がkeyの最初のタグの値。なければ空
+func value(tags nostr.Tags, key string) string {
+	// GetFirstは名前も前方一致で比べるので値まで指定する
+	if t := tags.GetFirst([]string{key, ""}); t != nil {
+		return t.Value()
+	}
+	return ""
+}
+
+// imeta はNIP-94のタグからNIP-92のimetaタグを作る
+func imeta(tags nostr.Tags, img *sink.Image) nostr.Tag {
+	t := nostr.Tag{"imeta"}
+	for _, tag := range tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "url", "m", "x", "ox", "dim", "blurhash":
+			t = append(t, tag[0]+" "+tag[1])
+		}
+	}
+	if value(tags, "m") == "" {
+		t = append(t, "m "+img.MimeType)
+	}
+	if value(tags, "dim") == "" {
+		t = append(t, fmt.Sprintf("dim %dx%d", shakemap.Width, shakemap.Height))
+	}
+	if img.Alt != "" {
+		t = append(t, "alt "+img.Alt)
+	}
+	return t
+}
+
+// attach は地図画像をアップロードして本文の末尾にURLを加え、imetaタグを付ける。
+// アップロード先がないか失敗した場合は画像なしで投稿する
+func (p *Publisher) attach(ctx context.Context, m sink.Message, tags nostr.Tags) (string, nostr.Tags) {
+	if m.Image == nil || p.uploader == nil {
+		return m.Text, tags
+	}
+	nip94, err := p.uploader.upload(ctx, m.Image)
+	if err != nil {
+		slog.Error("Failed to upload image", err, slog.Any("server", p.uploader.server))
+		return m.Text, tags
+	}
+	url := value(nip94, "url")
+	slog.Info("Succeed to upload image", slog.Any("url", url))
+	return m.Text + "\n" + url, append(tags, imeta(nip94, m.Image))
+}
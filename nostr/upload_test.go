@@ -0,0 +1,109 @@
+package nostr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matsuu/namazu/sink"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestUpload(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pub, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	img := &sink.Image{Data: []byte("png"), MimeType: "image/png", Alt: "震央の地図。"}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/nostr/nip96.json":
+			fmt.Fprintf(w, `{"api_url":"%s/upload"}`, srv.URL)
+			return
+		case "/upload":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		// NIP-98の署名とpayloadを確かめる
+		b, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Nostr ")
+		if !ok {
+			t.Errorf("no authorization: %q", r.Header.Get("Authorization"))
+		}
+		js, _ := base64.StdEncoding.DecodeString(token)
+		var e nostr.Event
+		if err := json.Unmarshal(js, &e); err != nil {
+			t.Errorf("invalid auth event: %v", err)
+		}
+		if ok, err := e.CheckSignature(); !ok || err != nil {
+			t.Errorf("invalid signature: %v", err)
+		}
+		sum := sha256.Sum256(b)
+		if e.Kind != kindHttpAuth || e.PubKey != pub || value(e.Tags, "u") != srv.URL+"/upload" || value(e.Tags, "method") != "POST" || value(e.Tags, "payload") != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected auth event: %+v", e)
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("no file: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if data, _ := io.ReadAll(f); string(data) != "png" {
+			t.Errorf("file got:%q", data)
+		}
+		if got := r.FormValue("alt"); got != img.Alt {
+			t.Errorf("alt got:%q want:%q", got, img.Alt)
+		}
+		fmt.Fprint(w, `{"status":"success","nip94_event":{"tags":[["url","https://example.com/map.png"],["ox","abc"],["m","image/png"]]}}`)
+	}))
+	defer srv.Close()
+
+	u := &uploader{server: srv.URL, sk: sk, pub: pub, client: srv.Client()}
+	tags, err := u.upload(context.Background(), img)
+	if err != nil {
+		t.Fatalf("failed to upload: %v", err)
+	}
+	want := nostr.Tag{"imeta", "url https://example.com/map.png", "ox abc", "m image/png", "dim 800x600", "alt 震央の地図。"}
+	if got := imeta(tags, img); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("imeta got:%v want:%v", got, want)
+	}
+
+	// nip96.jsonのないサーバーはエラー
+	u = &uploader{server: srv.URL + "/none", sk: sk, pub: pub, client: srv.Client()}
+	if _, err := u.upload(context.Background(), img); err == nil {
+		t.Errorf("no error")
+	}
+}
+
+func TestValue(t *testing.T) {
+	tags := nostr.Tags{{"method", "POST"}, {"m", "image/png"}, {"x"}}
+	tests := []struct {
+		Key  string
+		Want string
+	}{
+		// methodに前方一致しない
+		{"m", "image/png"},
+		{"method", "POST"},
+		{"x", ""},
+		{"url", ""},
+	}
+	for _, tt := range tests {
+		if got := value(tags, tt.Key); got != tt.Want {
+			t.Errorf("%s: got:%q want:%q", tt.Key, got, tt.Want)
+		}
+	}
+}
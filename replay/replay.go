@@ -0,0 +1,355 @@
+// Package replay は保存しておいた電文をeew.Runと同じように流し直す
+package replay
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/matsuu/namazu/archive"
+	"github.com/matsuu/namazu/eew"
+	"golang.org/x/exp/slog"
+)
+
+// Item は再生する電文
+type Item struct {
+	// 読み込んだファイル名
+	Name string
+	// Head/ReportDateTime
+	Time     time.Time
+	EventId  string
+	Serial   int
+	Telegram eew.Telegram
+}
+
+// ファイル名に含まれる電文種別コード
+var reType = regexp.MustCompile(`[A-Z]{4}\d{2}`)
+
+// ファイル名に種別コードがない場合はControl/Titleから推測する
+var titleTypes = map[string]string{
+	"緊急地震速報（警報）":    "VXSE43",
+	"緊急地震速報（予報）":    "VXSE44",
+	"緊急地震速報（地震動予報）": "VXSE45",
+	"震度速報":         "VXSE51",
+	"震源に関する情報":     "VXSE52",
+	"震源・震度に関する情報":  "VXSE53",
+	"津波警報・注意報・予報a": "VTSE41",
+	"津波情報a":        "VTSE51",
+}
+
+// newItem はnameの電文を読む。envがあれば種別とhead.testはenvから戻す
+func newItem(name string, body []byte, env *eew.WebsocketData) (*Item, error) {
+	item, err := parse(name, body)
+	if err != nil {
+		return nil, err
+	}
+	if env != nil {
+		if env.Head.Type != "" {
+			item.Telegram.Type = env.Head.Type
+		}
+		item.Telegram.Test = env.Head.Test
+	}
+	if item.Telegram.Type == "" {
+		return nil, fmt.Errorf("unknown telegram type")
+	}
+	return item, nil
+}
+
+// parseJSON はDMDATA.JPのJSON形式の電文を読む
+func parseJSON(name string, body []byte) (*Item, error) {
+	var h struct {
+		Title          string    `json:"title"`
+		ReportDateTime time.Time `json:"reportDateTime"`
+		EventId        string    `json:"eventId"`
+		SerialNo       string    `json:"serialNo"`
+	}
+	if err := json.Unmarshal(body, &h); err != nil {
+		return nil, err
+	}
+	item := Item{
+		Name:    name,
+		Time:    h.ReportDateTime,
+		EventId: h.EventId,
+		Telegram: eew.Telegram{
+			Body: body,
+		},
+	}
+	if h.SerialNo != "" {
+		serial, err := strconv.Atoi(h.SerialNo)
+		if err != nil {
+			return nil, err
+		}
+		item.Serial = serial
+	}
+	item.Telegram.Type = reType.FindString(filepath.Base(name))
+	if item.Telegram.Type == "" {
+		item.Telegram.Type = titleTypes[h.Title]
+	}
+	return &item, nil
+}
+
+func parse(name string, body []byte) (*Item, error) {
+	if eew.IsJSON(body) {
+		return parseJSON(name, body)
+	}
+	doc, err := xmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	root := xmlquery.FindOne(doc, "//Report")
+	if root == nil {
+		return nil, fmt.Errorf("no Report element")
+	}
+
+	item := Item{
+		Name: name,
+		Telegram: eew.Telegram{
+			Body: body,
+		},
+	}
+	if n := root.SelectElement("//Head/ReportDateTime"); n != nil {
+		t, err := time.Parse(time.RFC3339, n.InnerText())
+		if err != nil {
+			return nil, err
+		}
+		item.Time = t
+	}
+	if n := root.SelectElement("//Head/EventID"); n != nil {
+		item.EventId = n.InnerText()
+	}
+	if n := root.SelectElement("//Head/Serial"); n != nil && n.InnerText() != "" {
+		serial, err := strconv.Atoi(n.InnerText())
+		if err != nil {
+			return nil, err
+		}
+		item.Serial = serial
+	}
+
+	item.Telegram.Type = reType.FindString(filepath.Base(name))
+	if item.Telegram.Type == "" {
+		if n := root.SelectElement("//Control/Title"); n != nil {
+			item.Telegram.Type = titleTypes[n.InnerText()]
+		}
+	}
+	return &item, nil
+}
+
+type file struct {
+	name string
+	body []byte
+}
+
+// zipに含まれた2つ目以降の電文の連番
+var reIndex = regexp.MustCompile(`_\d+$`)
+
+// envelope はnameの電文と一緒にarchiveが保存したdataメッセージを返す
+func envelope(envelopes map[string]*eew.WebsocketData, name string) *eew.WebsocketData {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if env, ok := envelopes[base]; ok {
+		return env
+	}
+	return envelopes[reIndex.ReplaceAllString(base, "")]
+}
+
+// Load はXMLやJSONのファイル、ディレクトリ、zipまたはtar.gzから電文を読み込み、発表順に並べる
+//
+// archiveが保存したディレクトリならenvelopeから種別とhead.testも戻す
+func Load(paths ...string) ([]Item, error) {
+	var files []file
+	add := func(name string, body []byte) {
+		files = append(files, file{name: name, body: body})
+	}
+	for _, p := range paths {
+		if err := load(p, add); err != nil {
+			return nil, err
+		}
+	}
+
+	envelopes := make(map[string]*eew.WebsocketData)
+	for _, f := range files {
+		if !strings.HasSuffix(f.name, archive.EnvelopeSuffix) {
+			continue
+		}
+		var env eew.WebsocketData
+		if err := json.Unmarshal(f.body, &env); err != nil {
+			slog.Warn("Skip envelope", slog.Any("name", f.name), slog.Any("err", err))
+			continue
+		}
+		envelopes[strings.TrimSuffix(f.name, archive.EnvelopeSuffix)] = &env
+	}
+
+	var items []Item
+	for _, f := range files {
+		if strings.HasSuffix(f.name, archive.EnvelopeSuffix) {
+			continue
+		}
+		item, err := newItem(f.name, f.body, envelope(envelopes, f.name))
+		if err != nil {
+			slog.Warn("Skip file", slog.Any("name", f.name), slog.Any("err", err))
+			continue
+		}
+		items = append(items, *item)
+	}
+	Sort(items)
+	return items, nil
+}
+
+// isTelegram は電文またはenvelopeのファイルか
+func isTelegram(name string) bool {
+	return strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".json")
+}
+
+func load(path string, add func(name string, body []byte)) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if !isArchive(p) && !isTelegram(p) {
+				return nil
+			}
+			return load(p, add)
+		})
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !isTelegram(f.Name) {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return err
+			}
+			b, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+			add(f.Name, b)
+		}
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(zr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if h.Typeflag != tar.TypeReg || !isTelegram(h.Name) {
+				continue
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			add(h.Name, b)
+		}
+	default:
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		add(path, b)
+	}
+	return nil
+}
+
+func isArchive(path string) bool {
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort はReportDateTime、Serialの順に並べる。同じなら読み込んだ順
+func Sort(items []Item) {
+	slices.SortStableFunc(items, func(a, b Item) int {
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return a.Serial - b.Serial
+	})
+}
+
+// Player は電文を元の間隔で流す
+type Player struct {
+	// 1なら元の間隔、2なら倍速。0なら待たずに流す
+	Speed float64
+	// 電文の間隔の上限。0なら制限しない
+	MaxGap time.Duration
+}
+
+// wait は前の電文からcurまで待つ時間
+func (p Player) wait(prev, cur time.Time) time.Duration {
+	if p.Speed <= 0 || prev.IsZero() || cur.IsZero() {
+		return 0
+	}
+	d := time.Duration(float64(cur.Sub(prev)) / p.Speed)
+	if d < 0 {
+		return 0
+	}
+	if p.MaxGap > 0 && d > p.MaxGap {
+		return p.MaxGap
+	}
+	return d
+}
+
+// Play はitemsを順にsへ流す。ctxがキャンセルされたら中断する
+func (p Player) Play(ctx context.Context, items []Item, s eew.Sender) error {
+	var prev time.Time
+	for i, item := range items {
+		if d := p.wait(prev, item.Time); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		if err := s.Send(ctx, item.Telegram); err != nil {
+			return err
+		}
+		slog.Info("Succeed to replay telegram", slog.Any("no", i), slog.Any("name", item.Name), slog.Any("type", item.Telegram.Type), slog.Any("eventId", item.EventId), slog.Any("serial", item.Serial))
+		prev = item.Time
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package replay
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/matsuu/namazu/archive"
+	"github.com/matsuu/namazu/eew"
+)
+
+const sample = "../eew/samples/77_01_01_110311_VXSE45.xml"
+
+// writeSample はサンプルのSerialとReportDateTimeを書き換えてnameに保存する
+func writeSample(t *testing.T, name string, serial int, reportTime string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(sample)
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	b = regexp.MustCompile(`<Serial>\d+</Serial>`).ReplaceAll(b, []byte(fmt.Sprintf("<Serial>%d</Serial>", serial)))
+	b = regexp.MustCompile(`<ReportDateTime>[^<]+</ReportDateTime>`).ReplaceAll(b, []byte(fmt.Sprintf("<ReportDateTime>%s</ReportDateTime>", reportTime)))
+	if err := os.WriteFile(name, b, 0o644); err != nil {
+		t.Fatalf("failed to write sample: %v", err)
+	}
+	return b
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeSample(t, filepath.Join(dir, "c_VXSE45.xml"), 3, "2011-03-11T14:46:50+09:00")
+	writeSample(t, filepath.Join(dir, "a_VXSE45.xml"), 2, "2011-03-11T14:46:49+09:00")
+	writeSample(t, filepath.Join(dir, "b.xml"), 1, "2011-03-11T14:46:48+09:00")
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not xml"), 0o644)
+
+	// zipの中も読む
+	f, err := os.Create(filepath.Join(dir, "d.zip"))
+	if err != nil {
+		t.Fatalf("failed to create zip: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("d_VXSE45.xml")
+	w.Write(writeSample(t, filepath.Join(t.TempDir(), "d.xml"), 4, "2011-03-11T14:46:50+09:00"))
+	zw.Close()
+	f.Close()
+
+	items, err := Load(dir)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%s:%d:%s", filepath.Base(item.Name), item.Serial, item.Telegram.Type))
+	}
+	want := []string{"b.xml:1:VXSE45", "a_VXSE45.xml:2:VXSE45", "c_VXSE45.xml:3:VXSE45", "d_VXSE45.xml:4:VXSE45"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", got, want)
+	}
+}
+
+func TestLoadArchive(t *testing.T) {
+	dir := t.TempDir()
+	a, err := archive.New(dir)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	// JSON形式の訓練報
+	j, err := os.ReadFile("../eew/samples/77_01_01_110311_VXSE45.json")
+	if err != nil {
+		t.Fatalf("failed to open sample json: %v", err)
+	}
+	format := "json"
+	var data eew.WebsocketData
+	data.Id = "json"
+	data.Format = &format
+	data.Head.Type = "VXSE45"
+	data.Head.Time = time.Date(2011, 3, 11, 5, 48, 10, 0, time.UTC)
+	data.Head.Test = true
+	if err := a.Archive(&data, [][]byte{j}); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	// zipに2つ含まれていたXML。ファイル名の種別よりenvelopeを優先する
+	x1 := writeSample(t, filepath.Join(t.TempDir(), "1.xml"), 24, "2011-03-11T14:48:11+09:00")
+	x2 := writeSample(t, filepath.Join(t.TempDir(), "2.xml"), 25, "2011-03-11T14:48:12+09:00")
+	data = eew.WebsocketData{}
+	data.Id = "xml"
+	data.Head.Type = "VXSE44"
+	data.Head.Time = time.Date(2011, 3, 11, 5, 48, 12, 0, time.UTC)
+	if err := a.Archive(&data, [][]byte{x1, x2}); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	// デコードできなかったものはenvelopeだけなので流さない
+	data = eew.WebsocketData{}
+	data.Id = "broken"
+	data.Body = "!!!"
+	if err := a.Archive(&data, nil); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+
+	items, err := Load(dir)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%s:%d:%s:%v:%v", filepath.Ext(item.Name), item.Serial, item.Telegram.Type, item.Telegram.Test, eew.IsJSON(item.Telegram.Body)))
+	}
+	want := []string{".json:23:VXSE45:true:true", ".xml:24:VXSE44:false:false", ".xml:25:VXSE44:false:false"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", got, want)
+	}
+}
+
+func TestWait(t *testing.T) {
+	base := time.Date(2011, 3, 11, 14, 46, 48, 0, time.UTC)
+	tests := []struct {
+		Player Player
+		Prev   time.Time
+		Cur    time.Time
+		Want   time.Duration
+	}{
+		{Player{Speed: 1}, time.Time{}, base, 0},
+		{Player{Speed: 1}, base, base.Add(2 * time.Second), 2 * time.Second},
+		{Player{Speed: 2}, base, base.Add(2 * time.Second), time.Second},
+		{Player{Speed: 0}, base, base.Add(2 * time.Second), 0},
+		{Player{Speed: 1, MaxGap: time.Second}, base, base.Add(time.Minute), time.Second},
+		{Player{Speed: 1}, base, base.Add(-time.Second), 0},
+	}
+	for _, tt := range tests {
+		if got := tt.Player.wait(tt.Prev, tt.Cur); got != tt.Want {
+			t.Errorf("%+v got:%v want:%v", tt, got, tt.Want)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	items, err := Load("../eew/samples")
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	bus := eew.NewBus()
+	sub := bus.Subscribe("VXSE", "VTSE")
+	if err := (Player{Speed: 100, MaxGap: 100 * time.Millisecond}).Play(context.Background(), items, bus); err != nil {
+		t.Fatalf("failed to play: %v", err)
+	}
+	for _, item := range items {
+		got, err := sub.Recv()
+		if err != nil {
+			t.Fatalf("failed to recv: %v", err)
+		}
+		if got.Type != item.Telegram.Type || len(got.Body) != len(item.Telegram.Body) {
+			t.Errorf("got:%s want:%s", got.Type, item.Telegram.Type)
+		}
+	}
+}
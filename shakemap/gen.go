@@ -0,0 +1,292 @@
+//go:build ignore
+
+// gen は気象庁の予報区等GISデータ（地震情報／細分区域）のShapefileからdata/polygons.txtを作る
+//
+//	JMA_SHAPEFILE=path/to/area.shp go generate ./shakemap
+//
+// Shapefileを指定しない場合は、data/land.txtの陸地の輪郭をdata/points.tsvの代表点から
+// 最も近い区域に分けた近似の輪郭を作る
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matsuu/namazu/shakemap/internal/shp"
+)
+
+func main() {
+	var (
+		in        = flag.String("shp", "", "path to the shapefile of earthquake information areas. approximate with -land and -points if empty")
+		landFile  = flag.String("land", "data/land.txt", "outlines of land to approximate areas")
+		points    = flag.String("points", "data/points.tsv", "representative points of areas to approximate areas")
+		out       = flag.String("out", "data/polygons.txt", "output file")
+		areasFile = flag.String("areas", "data/areas.tsv", "known areas to check the codes")
+		field     = flag.String("field", "code", "attribute name of the area code")
+		tolerance = flag.Float64("tolerance", 0.005, "tolerance in degrees to simplify polygons")
+	)
+	flag.Parse()
+	known, err := readAreas(*areasFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 細分区域のコードごとの輪
+	var shapes map[string][][][2]float64
+	source := fmt.Sprintf("出典：気象庁 予報区等GISデータ（地震情報／細分区域）を加工して作成 (許容誤差 %g度)", *tolerance)
+	if *in == "" {
+		shapes, err = approximate(*landFile, *points, known)
+		source = "陸地の輪郭を細分区域の代表点で分けた近似。区域の境界は正確ではない"
+		// 区域ごとに簡略化すると隣の区域との間に隙間ができる。陸地の輪郭は簡略化済み
+		*tolerance = 0
+	} else {
+		shapes, err = readShapefile(*in, *field, known)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rings := make(map[string][]string)
+	for code, rs := range shapes {
+		for _, ring := range rs {
+			s := shp.Simplify(ring, *tolerance)
+			// 点になった小さな島は除く
+			if len(s) < 4 || shp.Area(s) < *tolerance**tolerance {
+				continue
+			}
+			points := make([]string, 0, len(s)-1)
+			// 最後の点は最初の点と同じなので省く
+			for _, p := range s[:len(s)-1] {
+				points = append(points, strconv.FormatFloat(p[0], 'f', 3, 64)+","+strconv.FormatFloat(p[1], 'f', 3, 64))
+			}
+			rings[code] = append(rings[code], strings.Join(points, " "))
+		}
+	}
+	for code := range known {
+		if len(rings[code]) == 0 {
+			log.Printf("no polygon: %s", code)
+		}
+	}
+
+	codes := make([]string, 0, len(rings))
+	for code := range rings {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# 細分区域の輪郭。1行に1つの輪を「コード 経度,緯度 ...」で書く。go generateで作る")
+	fmt.Fprintln(w, "#", source)
+	for _, code := range codes {
+		for _, ring := range rings[code] {
+			fmt.Fprintln(w, code, ring)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d areas to %s", len(codes), *out)
+}
+
+// readAreas はareas.tsvのコードを読む
+func readAreas(path string) (map[string]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, _, _ := strings.Cut(line, "\t")
+		known[code] = true
+	}
+	return known, nil
+}
+
+// readShapefile はShapefileの図形を細分区域のコードごとにまとめる
+func readShapefile(path, field string, known map[string]bool) (map[string][][][2]float64, error) {
+	rs, err := shp.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	shapes := make(map[string][][][2]float64)
+	for _, r := range rs {
+		code := r.Attrs[strings.ToLower(field)]
+		if code == "" {
+			return nil, fmt.Errorf("no %s in %v", field, r.Attrs)
+		}
+		if !known[code] {
+			log.Printf("skip unknown area: %s %v", code, r.Attrs)
+			continue
+		}
+		shapes[code] = append(shapes[code], r.Rings...)
+	}
+	return shapes, nil
+}
+
+// site は細分区域の代表点
+type site struct {
+	code string
+	// 経度、緯度
+	p [2]float64
+}
+
+// approximate は陸地の輪郭を、同じ陸地に属する代表点のうち最も近いものの区域に分ける。
+// 陸地の名前が細分区域のコードならその区域の島とする
+func approximate(landFile, pointsFile string, known map[string]bool) (map[string][][][2]float64, error) {
+	sites := make(map[string][]site)
+	b, err := os.ReadFile(pointsFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("invalid line in %s: %q", pointsFile, line)
+		}
+		lat, err1 := strconv.ParseFloat(f[2], 64)
+		lng, err2 := strconv.ParseFloat(f[3], 64)
+		if err1 != nil || err2 != nil || !known[f[0]] {
+			return nil, fmt.Errorf("invalid line in %s: %q", pointsFile, line)
+		}
+		sites[f[1]] = append(sites[f[1]], site{f[0], [2]float64{lng, lat}})
+	}
+
+	shapes := make(map[string][][][2]float64)
+	b, err = os.ReadFile(landFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		ring := make([][2]float64, 0, len(f))
+		for _, v := range f[1:] {
+			lng, lat, _ := strings.Cut(v, ",")
+			x, err1 := strconv.ParseFloat(lng, 64)
+			y, err2 := strconv.ParseFloat(lat, 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid point in %s: %q", landFile, v)
+			}
+			ring = append(ring, [2]float64{x, y})
+		}
+		land := f[0]
+		if known[land] {
+			shapes[land] = append(shapes[land], closed(ring))
+			continue
+		}
+		if len(sites[land]) == 0 {
+			return nil, fmt.Errorf("no area in %s", land)
+		}
+		// 経度方向の縮みを考えて距離を比べる
+		kx := math.Cos((ring[0][1] + ring[len(ring)/2][1]) / 2 * math.Pi / 180)
+		for _, s := range sites[land] {
+			cell := [][][2]float64{ring}
+			for _, o := range sites[land] {
+				if o == s {
+					continue
+				}
+				var next [][][2]float64
+				for _, r := range cell {
+					next = append(next, clip(r, s.p, o.p, kx)...)
+				}
+				cell = next
+			}
+			for _, r := range cell {
+				if len(r) >= 3 {
+					shapes[s.code] = append(shapes[s.code], closed(r))
+				}
+			}
+		}
+	}
+	return shapes, nil
+}
+
+// clip はringのうちoよりsに近い部分を残す。切れて離れた部分は別の輪になる
+func clip(ring [][2]float64, s, o [2]float64, kx float64) [][][2]float64 {
+	// sとoの垂直二等分線からの符号付きの距離。負ならsの側
+	dx, dy := (o[0]-s[0])*kx*kx, o[1]-s[1]
+	side := func(p [2]float64) float64 {
+		return (p[0]-(s[0]+o[0])/2)*dx + (p[1]-(s[1]+o[1])/2)*dy
+	}
+	// 輪の点に二等分線との交点を挟む
+	type node struct {
+		p [2]float64
+		// 交点なら線に沿った位置と、sの側へ入るかどうか
+		cross, enter bool
+		pos          float64
+		partner      int
+	}
+	var nodes []node
+	var crosses []int
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		dp, dq := side(p), side(q)
+		nodes = append(nodes, node{p: p})
+		if (dp <= 0) != (dq <= 0) {
+			t := dp / (dp - dq)
+			c := [2]float64{p[0] + t*(q[0]-p[0]), p[1] + t*(q[1]-p[1])}
+			crosses = append(crosses, len(nodes))
+			nodes = append(nodes, node{p: c, cross: true, enter: dp > 0, pos: c[0]*dy - c[1]*dx})
+		}
+	}
+	if len(crosses) == 0 {
+		if side(ring[0]) <= 0 {
+			return [][][2]float64{ring}
+		}
+		return nil
+	}
+	// 線に沿って並べた交点の2つずつが切り口の両端になる
+	sort.Slice(crosses, func(i, j int) bool { return nodes[crosses[i]].pos < nodes[crosses[j]].pos })
+	for k := 0; k+1 < len(crosses); k += 2 {
+		nodes[crosses[k]].partner, nodes[crosses[k+1]].partner = crosses[k+1], crosses[k]
+	}
+	// 入る交点から出る交点まで輪をたどり、切り口を渡って次の入る交点へ進む
+	var rings [][][2]float64
+	used := make(map[int]bool)
+	for _, start := range crosses {
+		if !nodes[start].enter || used[start] {
+			continue
+		}
+		var r [][2]float64
+		for i := start; !used[i]; {
+			used[i] = true
+			r = append(r, nodes[i].p)
+			for i = (i + 1) % len(nodes); !nodes[i].cross; i = (i + 1) % len(nodes) {
+				r = append(r, nodes[i].p)
+			}
+			r = append(r, nodes[i].p)
+			i = nodes[i].partner
+		}
+		rings = append(rings, r)
+	}
+	return rings
+}
+
+// closed は最後の点を最初の点と同じにする
+func closed(ring [][2]float64) [][2]float64 {
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring[:len(ring):len(ring)], ring[0])
+	}
+	return ring
+}
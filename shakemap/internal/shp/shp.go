@@ -0,0 +1,249 @@
+// Package shp はESRI Shapefileのポリゴンと属性を読む。地図データの生成にのみ使う
+package shp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Record はShapefileの1つの図形
+type Record struct {
+	// .dbfの属性。フィールド名は小文字にする
+	Attrs map[string]string
+	// 輪ごとの経度、緯度。最後の点は最初の点と同じ
+	Rings [][][2]float64
+}
+
+// Read はpathの.shpと同じ名前の.dbfを読む。削除済みの図形と空の図形は除く
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	shapes, err := ReadShapes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	dbfPath := strings.TrimSuffix(path, ".shp") + ".dbf"
+	d, err := os.Open(dbfPath)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	attrs, err := ReadAttrs(d)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dbfPath, err)
+	}
+	if len(shapes) != len(attrs) {
+		return nil, fmt.Errorf("number of records mismatch: shp:%d dbf:%d", len(shapes), len(attrs))
+	}
+	var rs []Record
+	for i, rings := range shapes {
+		if attrs[i] == nil || len(rings) == 0 {
+			continue
+		}
+		rs = append(rs, Record{Attrs: attrs[i], Rings: rings})
+	}
+	return rs, nil
+}
+
+// 図形の種類
+const (
+	shapeNull     = 0
+	shapePolygon  = 5
+	shapePolygonZ = 15
+	shapePolygonM = 25
+)
+
+// ReadShapes は.shpのポリゴンを読む。空の図形は輪のないものになる
+func ReadShapes(r io.Reader) ([][][][2]float64, error) {
+	var header [100]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if code := binary.BigEndian.Uint32(header[0:]); code != 9994 {
+		return nil, fmt.Errorf("invalid file code: %d", code)
+	}
+	var shapes [][][][2]float64
+	for {
+		var rh [8]byte
+		if _, err := io.ReadFull(r, rh[:]); err == io.EOF {
+			return shapes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// 長さは16ビット単位
+		content := make([]byte, 2*int(binary.BigEndian.Uint32(rh[4:])))
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, err
+		}
+		rings, err := polygon(content)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", binary.BigEndian.Uint32(rh[0:]), err)
+		}
+		shapes = append(shapes, rings)
+	}
+}
+
+// polygon はレコードの内容からポリゴンの輪を取り出す。Z値やM値は無視する
+func polygon(b []byte) ([][][2]float64, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("too short record")
+	}
+	le := binary.LittleEndian
+	switch typ := le.Uint32(b); typ {
+	case shapeNull:
+		return nil, nil
+	case shapePolygon, shapePolygonZ, shapePolygonM:
+	default:
+		return nil, fmt.Errorf("unsupported shape type: %d", typ)
+	}
+	if len(b) < 44 {
+		return nil, fmt.Errorf("too short polygon")
+	}
+	numParts, numPoints := int(le.Uint32(b[36:])), int(le.Uint32(b[40:]))
+	points := 44 + 4*numParts
+	if len(b) < points+16*numPoints {
+		return nil, fmt.Errorf("too short polygon: %d parts %d points", numParts, numPoints)
+	}
+	rings := make([][][2]float64, 0, numParts)
+	for i := 0; i < numParts; i++ {
+		start, end := int(le.Uint32(b[44+4*i:])), numPoints
+		if i+1 < numParts {
+			end = int(le.Uint32(b[44+4*(i+1):]))
+		}
+		if start > end || end > numPoints {
+			return nil, fmt.Errorf("invalid part %d: %d-%d", i, start, end)
+		}
+		ring := make([][2]float64, 0, end-start)
+		for j := start; j < end; j++ {
+			p := b[points+16*j:]
+			ring = append(ring, [2]float64{
+				math.Float64frombits(le.Uint64(p)),
+				math.Float64frombits(le.Uint64(p[8:])),
+			})
+		}
+		rings = append(rings, ring)
+	}
+	return rings, nil
+}
+
+// ReadAttrs は.dbfの属性を読む。削除済みのレコードはnilになる
+func ReadAttrs(r io.Reader) ([]map[string]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 32 {
+		return nil, fmt.Errorf("too short dbf")
+	}
+	le := binary.LittleEndian
+	numRecords := int(le.Uint32(b[4:]))
+	headerLen, recordLen := int(le.Uint16(b[8:])), int(le.Uint16(b[10:]))
+	type field struct {
+		name   string
+		length int
+	}
+	var fields []field
+	for off := 32; off+32 <= headerLen && b[off] != 0x0d; off += 32 {
+		name, _, _ := bytes.Cut(b[off:off+11], []byte{0})
+		fields = append(fields, field{strings.ToLower(string(name)), int(b[off+16])})
+	}
+	if len(b) < headerLen+numRecords*recordLen {
+		return nil, fmt.Errorf("too short dbf: %d records", numRecords)
+	}
+	attrs := make([]map[string]string, numRecords)
+	for i := range attrs {
+		rec := b[headerLen+i*recordLen : headerLen+(i+1)*recordLen]
+		if rec[0] == '*' {
+			continue
+		}
+		m := make(map[string]string, len(fields))
+		off := 1
+		for _, f := range fields {
+			if off+f.length > len(rec) {
+				return nil, fmt.Errorf("record %d: field %s overflows", i, f.name)
+			}
+			m[f.name] = strings.TrimSpace(string(rec[off : off+f.length]))
+			off += f.length
+		}
+		attrs[i] = m
+	}
+	return attrs, nil
+}
+
+// Simplify はDouglas-Peucker法でringからtolerance未満のずれの点を除く。
+// 閉じた輪は最初と最後の点を残す
+func Simplify(ring [][2]float64, tolerance float64) [][2]float64 {
+	if len(ring) < 3 {
+		return ring
+	}
+	keep := make([]bool, len(ring))
+	keep[0], keep[len(ring)-1] = true, true
+	// 閉じた輪は始点から最も遠い点で2つに分ける
+	if ring[0] == ring[len(ring)-1] {
+		far, best := 0, -1.0
+		for i, p := range ring {
+			if d := math.Hypot(p[0]-ring[0][0], p[1]-ring[0][1]); d > best {
+				far, best = i, d
+			}
+		}
+		keep[far] = true
+		simplify(ring, 0, far, tolerance, keep)
+		simplify(ring, far, len(ring)-1, tolerance, keep)
+	} else {
+		simplify(ring, 0, len(ring)-1, tolerance, keep)
+	}
+	var out [][2]float64
+	for i, p := range ring {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func simplify(ring [][2]float64, from, to int, tolerance float64, keep []bool) {
+	if to-from < 2 {
+		return
+	}
+	far, best := -1, tolerance
+	for i := from + 1; i < to; i++ {
+		if d := distance(ring[i], ring[from], ring[to]); d >= best {
+			far, best = i, d
+		}
+	}
+	if far < 0 {
+		return
+	}
+	keep[far] = true
+	simplify(ring, from, far, tolerance, keep)
+	simplify(ring, far, to, tolerance, keep)
+}
+
+// distance は点pと線分abの距離
+func distance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+}
+
+// Area は輪の面積の絶対値
+func Area(ring [][2]float64) float64 {
+	var s float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		s += ring[i][0]*ring[j][1] - ring[j][0]*ring[i][1]
+	}
+	return math.Abs(s) / 2
+}
@@ -0,0 +1,157 @@
+package shp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeShp はringsごとのポリゴンを持つ.shpを作る。nilは空の図形になる
+func writeShp(shapes [][][][2]float64) []byte {
+	var body bytes.Buffer
+	le := binary.LittleEndian
+	for i, rings := range shapes {
+		var c bytes.Buffer
+		if rings == nil {
+			binary.Write(&c, le, int32(shapeNull))
+		} else {
+			binary.Write(&c, le, int32(shapePolygon))
+			c.Write(make([]byte, 32))
+			n := 0
+			for _, r := range rings {
+				n += len(r)
+			}
+			binary.Write(&c, le, int32(len(rings)))
+			binary.Write(&c, le, int32(n))
+			start := 0
+			for _, r := range rings {
+				binary.Write(&c, le, int32(start))
+				start += len(r)
+			}
+			for _, r := range rings {
+				for _, p := range r {
+					binary.Write(&c, le, math.Float64bits(p[0]))
+					binary.Write(&c, le, math.Float64bits(p[1]))
+				}
+			}
+		}
+		binary.Write(&body, binary.BigEndian, int32(i+1))
+		binary.Write(&body, binary.BigEndian, int32(c.Len()/2))
+		body.Write(c.Bytes())
+	}
+	header := make([]byte, 100)
+	binary.BigEndian.PutUint32(header[0:], 9994)
+	binary.BigEndian.PutUint32(header[24:], uint32((100+body.Len())/2))
+	le.PutUint32(header[28:], 1000)
+	le.PutUint32(header[32:], shapePolygon)
+	return append(header, body.Bytes()...)
+}
+
+// writeDbf は文字型のフィールドnamesを持つ.dbfを作る。先頭が*のレコードは削除済みにする
+func writeDbf(names []string, width int, records [][]string) []byte {
+	le := binary.LittleEndian
+	headerLen := 32 + 32*len(names) + 1
+	recordLen := 1 + width*len(names)
+	b := make([]byte, 32)
+	b[0] = 3
+	le.PutUint32(b[4:], uint32(len(records)))
+	le.PutUint16(b[8:], uint16(headerLen))
+	le.PutUint16(b[10:], uint16(recordLen))
+	for _, n := range names {
+		f := make([]byte, 32)
+		copy(f, n)
+		f[11] = 'C'
+		f[16] = byte(width)
+		b = append(b, f...)
+	}
+	b = append(b, 0x0d)
+	for _, r := range records {
+		flag := byte(' ')
+		if len(r) > 0 && len(r[0]) > 0 && r[0][0] == '*' {
+			flag = '*'
+		}
+		b = append(b, flag)
+		for _, v := range r {
+			b = append(b, []byte(fmt.Sprintf("%-*s", width, v))...)
+		}
+	}
+	return append(b, 0x1a)
+}
+
+func TestRead(t *testing.T) {
+	square := [][2]float64{{140, 38}, {141, 38}, {141, 39}, {140, 39}, {140, 38}}
+	hole := [][2]float64{{140.2, 38.2}, {140.4, 38.2}, {140.4, 38.4}, {140.2, 38.2}}
+	island := [][2]float64{{142, 39}, {142.1, 39}, {142.1, 39.1}, {142, 39}}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "area.shp")
+	if err := os.WriteFile(path, writeShp([][][][2]float64{{square, hole}, {island}, nil, {square}}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dbf := writeDbf([]string{"CODE", "NAME"}, 8, [][]string{{"220", "miyagi"}, {"221", "island"}, {"222", "empty"}, {"*223", "deleted"}})
+	if err := os.WriteFile(filepath.Join(dir, "area.dbf"), dbf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := Read(path)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	// 空の図形と削除済みのものは除く
+	if len(rs) != 2 {
+		t.Fatalf("got:%d records want:2", len(rs))
+	}
+	if got := rs[0]; got.Attrs["code"] != "220" || got.Attrs["name"] != "miyagi" || fmt.Sprint(got.Rings) != fmt.Sprint([][][2]float64{square, hole}) {
+		t.Errorf("got:%v", got)
+	}
+	if got := rs[1]; got.Attrs["code"] != "221" || fmt.Sprint(got.Rings) != fmt.Sprint([][][2]float64{island}) {
+		t.Errorf("got:%v", got)
+	}
+
+	// .dbfとレコード数が合わない
+	if err := os.WriteFile(path, writeShp([][][][2]float64{{square}}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); err == nil {
+		t.Errorf("no error for mismatched records")
+	}
+	if _, err := ReadShapes(bytes.NewReader(make([]byte, 100))); err == nil {
+		t.Errorf("no error for invalid file code")
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		In   [][2]float64
+		Want [][2]float64
+	}{
+		// 直線上の点は除く
+		{
+			[][2]float64{{0, 0}, {1, 0.001}, {2, 0}, {2, 2}, {0, 2}, {0, 0}},
+			[][2]float64{{0, 0}, {2, 0}, {2, 2}, {0, 2}, {0, 0}},
+		},
+		// toleranceより大きいずれは残す
+		{
+			[][2]float64{{0, 0}, {1, 0.5}, {2, 0}, {2, 2}, {0, 2}, {0, 0}},
+			[][2]float64{{0, 0}, {1, 0.5}, {2, 0}, {2, 2}, {0, 2}, {0, 0}},
+		},
+		// 閉じていない線
+		{
+			[][2]float64{{0, 0}, {1, 0.001}, {2, 0}},
+			[][2]float64{{0, 0}, {2, 0}},
+		},
+	}
+	for _, tt := range tests {
+		if got := Simplify(tt.In, 0.01); fmt.Sprint(got) != fmt.Sprint(tt.Want) {
+			t.Errorf("%v: got:%v want:%v", tt.In, got, tt.Want)
+		}
+	}
+}
+
+func TestArea(t *testing.T) {
+	if got := Area([][2]float64{{0, 0}, {2, 0}, {2, 3}, {0, 3}, {0, 0}}); got != 6 {
+		t.Errorf("got:%v want:6", got)
+	}
+}
@@ -0,0 +1,347 @@
+// Package shakemap は震度の分布と震央を描いた地図画像を作る
+package shakemap
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+// 画像の大きさ
+const (
+	Width  = 800
+	Height = 600
+)
+
+// MimeType は作る画像の形式
+const MimeType = "image/png"
+
+// 輪郭はgen.goで作る。JMA_SHAPEFILEがなければ代表点による近似になる
+//
+//go:generate go run gen.go -shp=$JMA_SHAPEFILE
+
+//go:embed data/areas.tsv
+var areasTsv string
+
+//go:embed data/polygons.txt
+var polygonsTxt string
+
+// area は細分区域
+type area struct {
+	code string
+	name string
+}
+
+// shape は細分区域の輪郭。飛び地や島、穴は複数の輪にして偶奇規則で塗る
+type shape struct {
+	code string
+	// 輪ごとの経度、緯度
+	rings [][][2]float64
+	// 緯度経度の範囲
+	minLat, maxLat, minLng, maxLng float64
+}
+
+var (
+	areas  = mustAreas()
+	shapes = mustShapes(polygonsTxt)
+)
+
+// 色は気象庁の震度の配色に合わせる
+var (
+	seaColor     = color.RGBA{0x1b, 0x27, 0x35, 0xff}
+	landColor    = color.RGBA{0x4b, 0x55, 0x63, 0xff}
+	borderColor  = color.RGBA{0x2a, 0x33, 0x40, 0xff}
+	coastColor   = color.RGBA{0x9a, 0xa5, 0xb1, 0xff}
+	markColor    = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	outlineColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+	intensityColors = map[string]color.RGBA{
+		"1":  {0xf2, 0xf2, 0xff, 0xff},
+		"2":  {0x00, 0xaa, 0xff, 0xff},
+		"3":  {0x00, 0x41, 0xff, 0xff},
+		"4":  {0xfa, 0xe6, 0x96, 0xff},
+		"5-": {0xff, 0xe6, 0x00, 0xff},
+		"5+": {0xff, 0x99, 0x00, 0xff},
+		"6-": {0xff, 0x28, 0x00, 0xff},
+		"6+": {0xa5, 0x00, 0x21, 0xff},
+		"7":  {0xb4, 0x00, 0x68, 0xff},
+	}
+)
+
+func mustAreas() []area {
+	var as []area
+	s := bufio.NewScanner(strings.NewReader(areasTsv))
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			panic(fmt.Sprintf("invalid line in areas.tsv: %q", line))
+		}
+		as = append(as, area{code: code, name: name})
+	}
+	return as
+}
+
+func mustShapes(txt string) []shape {
+	shapes, err := parseShapes(txt)
+	if err != nil {
+		panic(err)
+	}
+	return shapes
+}
+
+// parseShapes はpolygons.txtを読んで細分区域のコードごとにまとめる
+func parseShapes(txt string) ([]shape, error) {
+	var shapes []shape
+	index := make(map[string]int)
+	s := bufio.NewScanner(strings.NewReader(txt))
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("too few points in polygons.txt: %q", line)
+		}
+		code := fields[0]
+		i, ok := index[code]
+		if !ok {
+			i = len(shapes)
+			index[code] = i
+			shapes = append(shapes, shape{
+				code:   code,
+				minLat: math.Inf(1), maxLat: math.Inf(-1),
+				minLng: math.Inf(1), maxLng: math.Inf(-1),
+			})
+		}
+		sh := &shapes[i]
+		ring := make([][2]float64, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			lng, lat, ok := strings.Cut(f, ",")
+			x, err1 := strconv.ParseFloat(lng, 64)
+			y, err2 := strconv.ParseFloat(lat, 64)
+			if !ok || err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid point in polygons.txt: %q", f)
+			}
+			ring = append(ring, [2]float64{x, y})
+			sh.minLat, sh.maxLat = math.Min(sh.minLat, y), math.Max(sh.maxLat, y)
+			sh.minLng, sh.maxLng = math.Min(sh.minLng, x), math.Max(sh.maxLng, x)
+		}
+		sh.rings = append(sh.rings, ring)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return shapes, nil
+}
+
+// lookup は細分区域をコード、なければ名前で探してコードを返す
+func lookup(code, name string) (string, bool) {
+	for _, a := range areas {
+		if a.code == code {
+			return a.code, true
+		}
+	}
+	for _, a := range areas {
+		if a.name == name {
+			return a.code, true
+		}
+	}
+	return "", false
+}
+
+// view は緯度経度を画像の座標に変える正距円筒図法の範囲
+type view struct {
+	// 左上の緯度経度
+	lat, lng float64
+	// 緯度1度あたりのピクセル数
+	scale float64
+	// 経度方向の縮み。中心の緯度のcos
+	kx float64
+}
+
+// point は緯度経度の画像上の座標
+func (v view) point(lat, lng float64) (float64, float64) {
+	return (lng - v.lng) * v.kx * v.scale, (v.lat - lat) * v.scale
+}
+
+const (
+	// 描く範囲の余白 (度)
+	margin = 1.0
+	// 描く範囲の最小の高さ (度)
+	minSpan = 4.0
+)
+
+// fit は震央と塗る区域がすべて収まる範囲を決める
+func fit(c *eew.Content, intensities map[string]string) view {
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLng, maxLng := math.Inf(1), math.Inf(-1)
+	add := func(lat, lng float64) {
+		minLat, maxLat = math.Min(minLat, lat), math.Max(maxLat, lat)
+		minLng, maxLng = math.Min(minLng, lng), math.Max(maxLng, lng)
+	}
+	if c.LatLng != nil {
+		add(c.LatLng.Lat, c.LatLng.Lng)
+	}
+	for _, sh := range shapes {
+		if _, ok := intensities[sh.code]; ok {
+			add(sh.minLat, sh.minLng)
+			add(sh.maxLat, sh.maxLng)
+		}
+	}
+	lat, lng := (minLat+maxLat)/2, (minLng+maxLng)/2
+	kx := math.Cos(lat * math.Pi / 180)
+	h := math.Max(maxLat-minLat+2*margin, minSpan)
+	w := math.Max((maxLng-minLng)*kx+2*margin, minSpan*Width/Height)
+	scale := math.Min(Width/w, Height/h)
+	return view{
+		lat:   lat + Height/2/scale,
+		lng:   lng - Width/2/(scale*kx),
+		scale: scale,
+		kx:    kx,
+	}
+}
+
+// rasterize は画素ごとに属する細分区域のコードを返す。海は空
+func (v view) rasterize() []string {
+	codes := make([]string, Width*Height)
+	for _, sh := range shapes {
+		// 画像の外にある区域は飛ばす
+		x0, y0 := v.point(sh.maxLat, sh.minLng)
+		x1, y1 := v.point(sh.minLat, sh.maxLng)
+		if x1 < 0 || y1 < 0 || x0 >= Width || y0 >= Height {
+			continue
+		}
+		var edges [][4]float64
+		for _, ring := range sh.rings {
+			for i := range ring {
+				j := (i + 1) % len(ring)
+				ax, ay := v.point(ring[i][1], ring[i][0])
+				bx, by := v.point(ring[j][1], ring[j][0])
+				edges = append(edges, [4]float64{ax, ay, bx, by})
+			}
+		}
+		// 偶奇規則で行ごとに塗る
+		var cross []float64
+		for py := max(0, int(y0)); py < min(Height, int(y1)+1); py++ {
+			yc := float64(py) + 0.5
+			cross = cross[:0]
+			for _, e := range edges {
+				if (e[1] <= yc) != (e[3] <= yc) {
+					cross = append(cross, e[0]+(yc-e[1])*(e[2]-e[0])/(e[3]-e[1]))
+				}
+			}
+			sort.Float64s(cross)
+			for k := 0; k+1 < len(cross); k += 2 {
+				from := max(0, int(math.Ceil(cross[k]-0.5)))
+				to := min(Width-1, int(math.Floor(cross[k+1]-0.5)))
+				for px := from; px <= to; px++ {
+					codes[py*Width+px] = sh.code
+				}
+			}
+		}
+	}
+	return codes
+}
+
+// Draw はcの細分区域ごとの震度と震央を描く。
+// 取消や津波、描くものがない場合はnil
+func Draw(c *eew.Content) *image.RGBA {
+	if c.IsCanceled() || c.IsTsunami() {
+		return nil
+	}
+	// 細分区域のコードごとの震度
+	intensities := make(map[string]string)
+	for _, a := range c.AreaIntensities() {
+		code, ok := lookup(a.Code, a.Name)
+		if !ok {
+			continue
+		}
+		if _, ok := intensityColors[a.Intensity]; !ok {
+			continue
+		}
+		if eew.IntensityRank(a.Intensity) > eew.IntensityRank(intensities[code]) {
+			intensities[code] = a.Intensity
+		}
+	}
+	if len(intensities) == 0 && c.LatLng == nil {
+		return nil
+	}
+	v := fit(c, intensities)
+	codes := v.rasterize()
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	for p, code := range codes {
+		x, y := p%Width, p/Width
+		col := seaColor
+		if code != "" {
+			col = landColor
+			if i, ok := intensities[code]; ok {
+				col = intensityColors[i]
+			}
+		}
+		// 右か下と区域が異なれば境界線にする
+		for _, q := range []int{p + 1, p + Width} {
+			if (q == p+1 && x == Width-1) || q >= len(codes) || codes[q] == code {
+				continue
+			}
+			if code == "" || codes[q] == "" {
+				col = coastColor
+			} else {
+				col = borderColor
+			}
+		}
+		img.SetRGBA(x, y, col)
+	}
+	if c.LatLng != nil {
+		x, y := v.point(c.LatLng.Lat, c.LatLng.Lng)
+		mark(img, int(x), int(y))
+	}
+	return img
+}
+
+// mark は震央に白で縁取った×印を描く
+func mark(img *image.RGBA, cx, cy int) {
+	const size = 10
+	for _, stroke := range []struct {
+		width int
+		col   color.RGBA
+	}{{2, outlineColor}, {1, markColor}} {
+		for d := -size; d <= size; d++ {
+			for dx := -stroke.width; dx <= stroke.width; dx++ {
+				for dy := -stroke.width; dy <= stroke.width; dy++ {
+					img.SetRGBA(cx+d+dx, cy+d+dy, stroke.col)
+					img.SetRGBA(cx+d+dx, cy-d+dy, stroke.col)
+				}
+			}
+		}
+	}
+}
+
+// PNG はDrawの画像をPNGにする。描くものがない場合はnil
+func PNG(c *eew.Content) ([]byte, error) {
+	img := Draw(c)
+	if img == nil {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
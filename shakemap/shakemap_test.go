@@ -0,0 +1,241 @@
+package shakemap
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+func readContent(t *testing.T, typ, file string) *eew.Content {
+	t.Helper()
+	b, err := os.ReadFile("../eew/samples/" + file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", file, err)
+	}
+	c, err := eew.Telegram{Type: typ, Body: b}.Content()
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", file, err)
+	}
+	return c
+}
+
+// useShapes はテストの間だけfileの輪郭を使う
+func useShapes(t *testing.T, file string) {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", file, err)
+	}
+	s, err := parseShapes(string(b))
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", file, err)
+	}
+	orig := shapes
+	shapes = s
+	t.Cleanup(func() { shapes = orig })
+}
+
+// inside は点が輪郭の中にあるかどうか。偶奇規則で判定する
+func (sh shape) inside(lat, lng float64) bool {
+	in := false
+	for _, ring := range sh.rings {
+		for i := range ring {
+			a, b := ring[i], ring[(i+1)%len(ring)]
+			if (a[1] <= lat) != (b[1] <= lat) && lng < a[0]+(lat-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+// 同梱の輪郭はすべての細分区域を持ち、代表点はその区域の中にある
+func TestShapes(t *testing.T) {
+	byCode := make(map[string]shape)
+	for _, sh := range shapes {
+		byCode[sh.code] = sh
+	}
+	for _, a := range areas {
+		if _, ok := byCode[a.code]; !ok {
+			t.Errorf("no shape: %s %s", a.code, a.name)
+		}
+	}
+	if len(shapes) != len(byCode) || len(shapes) != len(areas) {
+		t.Errorf("got:%d shapes want:%d", len(shapes), len(areas))
+	}
+	b, err := os.ReadFile("data/points.tsv")
+	if err != nil {
+		t.Fatalf("failed to read points: %v", err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var code, land string
+		var lat, lng float64
+		if _, err := fmt.Sscan(line, &code, &land, &lat, &lng); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		if !byCode[code].inside(lat, lng) {
+			t.Errorf("%s: %v,%v is not inside", code, lat, lng)
+		}
+	}
+
+	if _, err := parseShapes("220 140,38 141,38"); err == nil {
+		t.Errorf("no error for too few points")
+	}
+	if _, err := parseShapes("220 140,38 141,38 141,x"); err == nil {
+		t.Errorf("no error for invalid point")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		Code string
+		Name string
+		Want string
+	}{
+		{"220", "", "220"},
+		{"", "宮城県北部", "220"},
+		{"9999", "伊豆大島", "355"},
+	}
+	for _, tt := range tests {
+		code, ok := lookup(tt.Code, tt.Name)
+		if !ok || code != tt.Want {
+			t.Errorf("%s %s: got:%s,%v want:%s", tt.Code, tt.Name, code, ok, tt.Want)
+		}
+	}
+	if _, ok := lookup("9999", "不明"); ok {
+		t.Errorf("unknown area is found")
+	}
+}
+
+func TestDraw(t *testing.T) {
+	c := readContent(t, "VXSE45", "77_01_01_110311_VXSE45.xml")
+	img := Draw(c)
+	if img == nil {
+		t.Fatalf("no image")
+	}
+	intensities := make(map[string]string)
+	for _, a := range c.AreaIntensities() {
+		intensities[a.Code] = a.Intensity
+	}
+	v := fit(c, intensities)
+	// 細分区域の代表点の色
+	for _, tt := range []struct {
+		Name string
+		Lat  float64
+		Lng  float64
+		Want color.RGBA
+	}{
+		{"宮城県北部", 38.7, 141.0, intensityColors["6+"]},
+		{"福島県浜通り", 37.3, 140.9, intensityColors["6-"]},
+		{"茨城県北部", 36.55, 140.4, intensityColors["5+"]},
+		{"新潟県佐渡", 38.0, 138.4, intensityColors["4"]},
+		// 震度のない区域は陸地の色
+		{"石川県加賀", 36.4, 136.5, landColor},
+		{"海", 39.0, 143.5, seaColor},
+	} {
+		x, y := v.point(tt.Lat, tt.Lng)
+		if got := img.RGBAAt(int(x), int(y)); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Name, got, tt.Want)
+		}
+	}
+	x, y := v.point(c.LatLng.Lat, c.LatLng.Lng)
+	if got := img.RGBAAt(int(x), int(y)); got != markColor {
+		t.Errorf("epicenter: got:%v want:%v", got, markColor)
+	}
+
+	// 震源のみの地震情報は震央だけ描く
+	if img := Draw(readContent(t, "VXSE52", "77_01_04_110311_VXSE52.xml")); img == nil {
+		t.Errorf("no image for hypocenter")
+	}
+	// 取消や津波は描かない
+	for _, tt := range []struct {
+		Type string
+		File string
+	}{
+		{"VXSE45", "77_01_02_110311_VXSE45.xml"},
+		{"VTSE41", "77_01_06_110311_VTSE41.xml"},
+	} {
+		if img := Draw(readContent(t, tt.Type, tt.File)); img != nil {
+			t.Errorf("%s: unexpected image", tt.File)
+		}
+	}
+	if img := Draw(&eew.Content{}); img != nil {
+		t.Errorf("unexpected image for empty content")
+	}
+}
+
+// 穴や飛び地、境界線と海岸線をテスト用の区域で確かめる
+func TestRasterize(t *testing.T) {
+	useShapes(t, "testdata/polygons.txt")
+	c := readContent(t, "VXSE45", "77_01_01_110311_VXSE45.xml")
+	img := Draw(c)
+	if img == nil {
+		t.Fatalf("no image")
+	}
+	intensities := make(map[string]string)
+	for _, a := range c.AreaIntensities() {
+		intensities[a.Code] = a.Intensity
+	}
+	v := fit(c, intensities)
+	for _, tt := range []struct {
+		Name string
+		Lat  float64
+		Lng  float64
+		Want color.RGBA
+	}{
+		{"宮城県北部", 38.75, 141.0, intensityColors["6+"]},
+		{"福島県浜通り", 37.1, 140.7, intensityColors["6-"]},
+		// 穴は塗らない
+		{"福島県浜通りの穴", 37.4, 141.0, seaColor},
+		{"福島県浜通りの飛び地", 37.25, 142.1, intensityColors["6-"]},
+		{"茨城県北部", 36.7, 140.4, intensityColors["5+"]},
+		{"海", 38.0, 142.0, seaColor},
+	} {
+		x, y := v.point(tt.Lat, tt.Lng)
+		if got := img.RGBAAt(int(x), int(y)); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Name, got, tt.Want)
+		}
+	}
+	// 区域の境目は境界線、海との境目は海岸線
+	for _, tt := range []struct {
+		Name string
+		Lat  float64
+		Lng  float64
+		Want color.RGBA
+	}{
+		{"宮城県北部の海岸線", 38.75, 140.5, coastColor},
+		{"福島県浜通りと茨城県北部の境界線", 37.0, 140.6, borderColor},
+	} {
+		x, y := v.point(tt.Lat, tt.Lng)
+		found := false
+		for d := -2; d <= 2; d++ {
+			found = found || img.RGBAAt(int(x)+d, int(y)) == tt.Want || img.RGBAAt(int(x), int(y)+d) == tt.Want
+		}
+		if !found {
+			t.Errorf("%s: no line around %v,%v", tt.Name, tt.Lat, tt.Lng)
+		}
+	}
+}
+
+func TestPNG(t *testing.T) {
+	b, err := PNG(readContent(t, "VXSE53", "77_01_05_110311_VXSE53.xml"))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if got := img.Bounds().Size(); got.X != Width || got.Y != Height {
+		t.Errorf("got:%v want:%dx%d", got, Width, Height)
+	}
+}
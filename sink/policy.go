@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+// Reports はスレッドの続報をどれだけ投稿するか
+type Reports string
+
+const (
+	// すべての報を投稿する
+	ReportsAll Reports = "all"
+	// 初報と最終報のみ投稿する
+	ReportsFirstLast Reports = "first-last"
+	// 最大予測震度が変わった場合のみ投稿する
+	ReportsIntensityChange Reports = "intensity-change"
+)
+
+func ParseReports(s string) (Reports, error) {
+	switch r := Reports(s); r {
+	case ReportsAll, ReportsFirstLast, ReportsIntensityChange:
+		return r, nil
+	case "":
+		return ReportsAll, nil
+	}
+	return "", fmt.Errorf("unknown reports: %s", s)
+}
+
+// ParseIntensity は震度階級を検証する。空は制限なしを表す
+func ParseIntensity(s string) (string, error) {
+	if s == "" || eew.IntensityRank(s) >= 0 {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown intensity: %s", s)
+}
+
+// ParseLgIntensity は長周期地震動階級を検証する。空は制限なしを表す
+func ParseLgIntensity(s string) (string, error) {
+	if s == "" || eew.LgIntensityRank(s) >= 0 {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown long-period ground motion class: %s", s)
+}
+
+// Policy は投稿するかどうかの判定条件
+// MinIntensity、MinLgIntensity、MinMagnitude、Areasはスレッドを始めるかどうかの判定に使い、
+// 一度投稿したスレッドの続報はReportsに従う。
+// 緊急地震速報（警報）はAreasのみで判定し、続報もすべて投稿する。
+// 津波は津波注意報以上が発表されていればスレッドを始める
+type Policy struct {
+	Reports Reports
+	// 最大予測震度の下限。"4"や"5-"など。空なら制限なし
+	MinIntensity string
+	// 最大予測長周期地震動階級の下限。"1"〜"4"。空なら制限なし。
+	// MinIntensityと両方指定した場合はいずれかに達すれば投稿する
+	MinLgIntensity string
+	// マグニチュードの下限。0なら制限なし。不明な場合は投稿しない
+	MinMagnitude float64
+	// 府県予報区または細分区域のコード。いずれかの区域で予測震度が発表された場合のみ投稿する
+	Areas []string
+}
+
+// Allow はcontentを投稿するかを判定する。tはスレッドがまだなければnil
+func (p Policy) Allow(c *eew.Content, t *Thread) bool {
+	if c.IsWarning() {
+		return t != nil || p.warnedAreas(c)
+	}
+	if c.IsTsunami() {
+		// 津波予報区は地震の区域とコードが異なるので閾値もAreasも使わない
+		return t != nil || c.Tsunami.HasAdvisory()
+	}
+	if t != nil {
+		return p.allowReply(c, t)
+	}
+	if p.MinMagnitude > 0 {
+		m, ok := c.Magnitude.Float()
+		if !ok || m < p.MinMagnitude {
+			return false
+		}
+	}
+	if len(p.Areas) > 0 {
+		return slices.ContainsFunc(c.Areas, func(a eew.ForecastArea) bool {
+			if !slices.Contains(p.Areas, a.PrefCode) && !slices.Contains(p.Areas, a.Code) {
+				return false
+			}
+			return p.reachIntensity(a.Intensity, a.LgIntensity)
+		})
+	}
+	return p.reachIntensity(c.Intensity, c.LgIntensity)
+}
+
+// warnedAreas はAreasのいずれかが警報の対象かどうか
+func (p Policy) warnedAreas(c *eew.Content) bool {
+	if len(p.Areas) == 0 {
+		return true
+	}
+	if w := c.Warning; w != nil {
+		for _, areas := range [][]eew.WarningArea{w.Prefs, w.Areas} {
+			if slices.ContainsFunc(areas, func(a eew.WarningArea) bool {
+				return slices.Contains(p.Areas, a.Code)
+			}) {
+				return true
+			}
+		}
+	}
+	return slices.ContainsFunc(c.Areas, func(a eew.ForecastArea) bool {
+		return slices.Contains(p.Areas, a.PrefCode) || slices.Contains(p.Areas, a.Code)
+	})
+}
+
+func (p Policy) allowReply(c *eew.Content, t *Thread) bool {
+	switch p.Reports {
+	case ReportsFirstLast:
+		return bool(c.IsLast)
+	case ReportsIntensityChange:
+		return c.Intensity.Max() != t.Intensity
+	}
+	return true
+}
+
+func (p Policy) reachIntensity(i, lg *eew.Intensity) bool {
+	if p.MinIntensity == "" && p.MinLgIntensity == "" {
+		return true
+	}
+	if p.MinIntensity != "" && eew.IntensityRank(i.Max()) >= eew.IntensityRank(p.MinIntensity) {
+		return true
+	}
+	return p.MinLgIntensity != "" && eew.LgIntensityRank(lg.Max()) >= eew.LgIntensityRank(p.MinLgIntensity)
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"os"
+	"testing"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+func readContent(t *testing.T, file string) *eew.Content {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	defer f.Close()
+	content, err := eew.NewContent(f)
+	if err != nil {
+		t.Fatalf("failed to parseXml: %v", err)
+	}
+	return content
+}
+
+func TestPolicy(t *testing.T) {
+	content := readContent(t, report)
+
+	tests := []struct {
+		Name   string
+		Policy Policy
+		Thread *Thread
+		Want   bool
+	}{
+		{"default", Policy{}, nil, true},
+		{"min intensity reached", Policy{MinIntensity: "6+"}, nil, true},
+		{"min intensity not reached", Policy{MinIntensity: "7"}, nil, false},
+		{"min magnitude reached", Policy{MinMagnitude: 8.4}, nil, true},
+		{"min magnitude not reached", Policy{MinMagnitude: 8.5}, nil, false},
+		// 大阪府南部は震度3
+		{"area", Policy{Areas: []string{"521"}}, nil, true},
+		{"area with intensity", Policy{Areas: []string{"521"}, MinIntensity: "4"}, nil, false},
+		{"pref", Policy{Areas: []string{"9040"}, MinIntensity: "6+"}, nil, true},
+		{"unknown area", Policy{Areas: []string{"999"}}, nil, false},
+		{"min lg intensity reached", Policy{MinLgIntensity: "4"}, nil, true},
+		// 震度と長周期地震動階級はいずれかに達すればよい
+		{"min lg intensity or intensity", Policy{MinIntensity: "7", MinLgIntensity: "4"}, nil, true},
+		// 大阪府南部は長周期地震動階級3
+		{"area with lg intensity", Policy{Areas: []string{"521"}, MinIntensity: "4", MinLgIntensity: "3"}, nil, true},
+		{"area with lg intensity not reached", Policy{Areas: []string{"521"}, MinLgIntensity: "4"}, nil, false},
+		// 続報は閾値ではなくReportsで判定する
+		{"reply all", Policy{MinIntensity: "7"}, &Thread{}, true},
+		{"reply first-last", Policy{Reports: ReportsFirstLast}, &Thread{}, false},
+		{"reply intensity unchanged", Policy{Reports: ReportsIntensityChange}, &Thread{Intensity: "6+"}, false},
+		{"reply intensity changed", Policy{Reports: ReportsIntensityChange}, &Thread{Intensity: "5-"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.Policy.Allow(content, tt.Thread); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Name, got, tt.Want)
+		}
+	}
+}
+
+func TestPolicyWarning(t *testing.T) {
+	content := readContent(t, warning)
+
+	tests := []struct {
+		Name   string
+		Policy Policy
+		Thread *Thread
+		Want   bool
+	}{
+		{"thresholds", Policy{MinIntensity: "7", MinMagnitude: 9}, nil, true},
+		{"pref", Policy{Areas: []string{"9040"}}, nil, true},
+		// 大阪府南部は新たに警報の対象となった
+		{"area", Policy{Areas: []string{"521"}}, nil, true},
+		{"unknown area", Policy{Areas: []string{"999"}}, nil, false},
+		{"reply first-last", Policy{Reports: ReportsFirstLast}, &Thread{}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.Policy.Allow(content, tt.Thread); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Name, got, tt.Want)
+		}
+	}
+}
+
+func TestPolicyTsunami(t *testing.T) {
+	content := readContent(t, tsunami)
+
+	tests := []struct {
+		Name   string
+		Policy Policy
+		Thread *Thread
+		Want   bool
+	}{
+		{"thresholds", Policy{MinIntensity: "7", MinMagnitude: 9}, nil, true},
+		// 津波予報区のコードは地震の区域と異なるのでAreasは使わない
+		{"areas", Policy{Areas: []string{"999"}}, nil, true},
+		{"reply first-last", Policy{Reports: ReportsFirstLast}, &Thread{}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.Policy.Allow(content, tt.Thread); got != tt.Want {
+			t.Errorf("%s: got:%v want:%v", tt.Name, got, tt.Want)
+		}
+	}
+
+	// 津波予報のみなら投稿しない
+	content.Tsunami = &eew.Tsunami{Areas: []eew.TsunamiArea{{Category: eew.TsunamiForecast}}}
+	if (Policy{}).Allow(content, nil) {
+		t.Errorf("forecast: got:true want:false")
+	}
+}
@@ -0,0 +1,440 @@
+// Package sink はZeroMQから受け取った電文を各SNSへ投稿する共通処理
+package sink
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/shakemap"
+	"github.com/matsuu/namazu/state"
+	"golang.org/x/exp/slog"
+)
+
+// Topics はSNSへ投稿する電文種別
+var Topics = []string{"VXSE43", "VXSE45", "VXSE51", "VXSE52", "VXSE53", "VTSE41", "VTSE51"}
+
+// Ref はSNS上の投稿を指す
+type Ref struct {
+	Id string `json:"id"`
+	// blueskyのようにIDとは別にハッシュが必要な場合に使う
+	Cid string `json:"cid,omitempty"`
+}
+
+// Thread はEventIDごとの投稿状態
+type Thread struct {
+	EventId string
+	Serial  int
+	// 最後に投稿した警報の報数。警報と予報は同じ報数で発表されるので別に持つ
+	WarningSerial int
+	Root          Ref
+	Last          Ref
+	// 最後に投稿した最大予測震度
+	Intensity string
+	// 地震情報のControl/Titleごとに最後に投稿した報数
+	InfoSerials map[string]int
+	// 津波の電文はSerialがないので、Control/Titleごとに最後に投稿したReportDateTimeを持つ
+	TsunamiReports map[string]time.Time
+	// 投稿した津波の電文。津波の取消時にはこれだけを削除する
+	TsunamiPosts []Ref
+	// 地震情報のControl/Titleごとに投稿したもの。地震情報の取消時にはこれだけを削除する
+	InfoPosts map[string][]Ref
+	// これまでに投稿したもの。取消時に削除する
+	Posts     []Ref
+	Canceled  bool
+	ExpiresAt time.Time
+}
+
+// Message はSNSに投稿する内容
+type Message struct {
+	Text    string
+	Content *eew.Content
+	// 投稿文の言語。Mastodonなどの言語タグに使う
+	Language eew.Language
+	// 添付する地図画像。なければnil
+	Image *Image
+}
+
+// Image は投稿に添付する画像
+type Image struct {
+	Data     []byte
+	MimeType string
+	// 代替テキスト
+	Alt string
+}
+
+// Publisher は各SNSへの投稿を行う
+type Publisher interface {
+	// Post は新しくスレッドを始める
+	Post(ctx context.Context, m Message) (Ref, error)
+	// Reply はスレッドの最後の投稿に返信する
+	Reply(ctx context.Context, m Message, t *Thread) (Ref, error)
+	// Retract はスレッドの最後の投稿への返信として取消を投稿する。
+	// 可能であればDeletableの投稿を削除する
+	Retract(ctx context.Context, m Message, t *Thread) (Ref, error)
+}
+
+// Source は電文の受信元。ZeroMQのeew.Subscriberやプロセス内のeew.Subscription
+type Source interface {
+	Recv() (*eew.Telegram, error)
+	Close() error
+}
+
+// Runner は受信、解析、重複排除、投稿判定、状態管理を行いPublisherへ投稿する
+type Runner struct {
+	// Storeのキーとログに使う
+	Name      string
+	Publisher Publisher
+	Store     state.Store
+	Training  TrainingMode
+	Policy    Policy
+	// 言語ごとに投稿文を作り、それぞれスレッドを分けて投稿する。空ならeew.DefaultRendererのみ
+	Renderers []*eew.Renderer
+	// trueなら震度分布と震央の地図画像を添付する
+	Map bool
+}
+
+// Run はctxがキャンセルされるかsrcが閉じられるまで電文を処理する
+func (r *Runner) Run(ctx context.Context, src Source) error {
+	go state.RunExpire(ctx, r.Store, time.Hour)
+
+	// 受信待ちを解除する
+	stop := context.AfterFunc(ctx, func() {
+		src.Close()
+	})
+	defer stop()
+
+	for {
+		tg, err := src.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("Failed to receive from pubsub", err, slog.Any("sink", r.Name))
+			return err
+		}
+		slog.Info("Succeed to receive from pubsub", slog.Any("sink", r.Name), slog.Any("type", tg.Type), slog.Any("test", tg.Test))
+		if err := r.Handle(ctx, tg); err != nil {
+			return err
+		}
+	}
+}
+
+// stateKey はスレッドの状態を保存するキー。
+// 最初のRenderer以外は言語ごとに別のスレッドになるようlangを加える
+func (r *Runner) stateKey(lang eew.Language, eventId string) string {
+	if lang == "" {
+		return r.Name + ":" + eventId
+	}
+	return r.Name + "/" + string(lang) + ":" + eventId
+}
+
+// Handle は電文を1件処理する。投稿に失敗した場合のみエラーを返す
+func (r *Runner) Handle(ctx context.Context, tg *eew.Telegram) error {
+	content, err := tg.Content()
+	if err != nil {
+		slog.Error("Failed to parse xml", err, slog.Any("sink", r.Name))
+		return nil
+	}
+	ok, label := r.Training.Allow(content)
+	if !ok {
+		slog.Info("Skip by training mode", slog.Any("sink", r.Name), slog.Any("mode", r.Training), slog.Any("status", content.Status), slog.Any("test", content.Test))
+		return nil
+	}
+	renderers := r.Renderers
+	if len(renderers) == 0 {
+		renderers = []*eew.Renderer{eew.DefaultRenderer}
+	}
+	// 地図は言語によらないので1度だけ描く
+	var img []byte
+	if r.Map {
+		if img, err = shakemap.PNG(content); err != nil {
+			// 地図がなくても投稿は続ける
+			slog.Error("Failed to draw map", err, slog.Any("sink", r.Name), slog.Any("eventId", content.EventId))
+		}
+	}
+	for i, renderer := range renderers {
+		var lang eew.Language
+		if i > 0 {
+			lang = renderer.Language()
+		}
+		if err := r.handle(ctx, content, renderer, label, img, r.stateKey(lang, content.EventId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle はrendererで作った投稿文をkeyのスレッドへ投稿する。imgがあれば添付する
+func (r *Runner) handle(ctx context.Context, content *eew.Content, renderer *eew.Renderer, label bool, img []byte, key string) error {
+	text, err := renderer.Render(content, label)
+	if err != nil {
+		slog.Error("Failed to render message", err, slog.Any("sink", r.Name), slog.Any("language", renderer.Language()), slog.Any("template", eew.TemplateName(content)))
+		return nil
+	}
+	m := Message{
+		Text:     text,
+		Content:  content,
+		Language: renderer.Language(),
+	}
+	if img != nil {
+		alt, err := renderer.Alt(content)
+		if err != nil {
+			slog.Error("Failed to render alt text", err, slog.Any("sink", r.Name), slog.Any("language", renderer.Language()))
+		}
+		m.Image = &Image{Data: img, MimeType: shakemap.MimeType, Alt: alt}
+	}
+	serial := int(content.Serial)
+	warning := content.IsWarning()
+
+	var t Thread
+	found, err := r.Store.Load(key, &t)
+	if err != nil {
+		slog.Error("Failed to load state", err, slog.Any("sink", r.Name), slog.Any("key", key))
+	}
+
+	if content.IsEarthquakeInfo() {
+		return r.followUp(ctx, m, key, &t, found)
+	}
+	if content.IsTsunami() {
+		return r.tsunami(ctx, m, key, &t, found)
+	}
+
+	var ref Ref
+	switch {
+	case found && t.Canceled:
+		slog.Info("Skip canceled event", slog.Any("sink", r.Name), slog.Any("thread", t))
+		return nil
+	case content.IsCanceled():
+		if !found {
+			// 投稿していないものは取り消す必要がない
+			slog.Info("Skip cancellation of unknown event", slog.Any("sink", r.Name), slog.Any("eventId", content.EventId))
+			return nil
+		}
+		// 最初の投稿だけ残し、取消はそれに返信する
+		retracted := t
+		retracted.Last = t.Root
+		ref, err = r.Publisher.Retract(ctx, m, &retracted)
+		if err != nil {
+			return fmt.Errorf("failed to retract: %w", err)
+		}
+		t.Posts = []Ref{t.Root}
+		t.Canceled = true
+	case !found:
+		if !r.Policy.Allow(content, nil) {
+			slog.Info("Skip by policy", slog.Any("sink", r.Name), slog.Any("eventId", content.EventId), slog.Any("serial", serial))
+			return nil
+		}
+		ref, err = r.Publisher.Post(ctx, m)
+		if err != nil {
+			return fmt.Errorf("failed to post: %w", err)
+		}
+		t = Thread{
+			EventId: content.EventId,
+			Root:    ref,
+		}
+	default:
+		// 過去報もしくは同じものが届いた場合はスキップ
+		last := t.Serial
+		if warning {
+			last = t.WarningSerial
+		}
+		if serial <= last {
+			slog.Info("Skip old serial", slog.Any("sink", r.Name), slog.Any("serial", serial), slog.Any("thread", t))
+			return nil
+		}
+		if !r.Policy.Allow(content, &t) {
+			slog.Info("Skip by policy", slog.Any("sink", r.Name), slog.Any("eventId", content.EventId), slog.Any("serial", serial))
+			return nil
+		}
+		ref, err = r.Publisher.Reply(ctx, m, &t)
+		if err != nil {
+			return fmt.Errorf("failed to reply: %w", err)
+		}
+	}
+	slog.Info("Succeed to post", slog.Any("sink", r.Name), slog.Any("ref", ref), slog.Any("text", m.Text))
+
+	if warning {
+		t.WarningSerial = max(t.WarningSerial, serial)
+	} else {
+		t.Serial = max(t.Serial, serial)
+	}
+	// 警報には予測震度が含まれない
+	if content.Intensity != nil {
+		t.Intensity = content.Intensity.Max()
+	}
+	r.save(key, &t, ref)
+	return nil
+}
+
+// followUp は震度速報などの地震情報を緊急地震速報のスレッドへ返信する
+func (r *Runner) followUp(ctx context.Context, m Message, key string, t *Thread, found bool) error {
+	c := m.Content
+	serial := int(c.Serial)
+	switch {
+	case !found:
+		// 緊急地震速報を投稿していない地震は扱わない
+		slog.Info("Skip earthquake information without thread", slog.Any("sink", r.Name), slog.Any("eventId", c.EventId), slog.Any("title", c.Title))
+		return nil
+	case t.Canceled:
+		slog.Info("Skip canceled event", slog.Any("sink", r.Name), slog.Any("thread", t))
+		return nil
+	case c.IsCanceled():
+		return r.retractInfo(ctx, m, key, t)
+	case serial <= t.InfoSerials[c.Title]:
+		slog.Info("Skip old serial", slog.Any("sink", r.Name), slog.Any("title", c.Title), slog.Any("serial", serial), slog.Any("thread", t))
+		return nil
+	}
+	ref, err := r.Publisher.Reply(ctx, m, t)
+	if err != nil {
+		return fmt.Errorf("failed to reply: %w", err)
+	}
+	slog.Info("Succeed to post", slog.Any("sink", r.Name), slog.Any("ref", ref), slog.Any("text", m.Text))
+
+	if t.InfoSerials == nil {
+		t.InfoSerials = make(map[string]int)
+	}
+	t.InfoSerials[c.Title] = serial
+	if t.InfoPosts == nil {
+		t.InfoPosts = make(map[string][]Ref)
+	}
+	t.InfoPosts[c.Title] = append(t.InfoPosts[c.Title], ref)
+	r.save(key, t, ref)
+	return nil
+}
+
+// retractInfo は地震情報の取消を投稿し、同じControl/Titleの地震情報の投稿だけを削除する
+func (r *Runner) retractInfo(ctx context.Context, m Message, key string, t *Thread) error {
+	c := m.Content
+	if len(t.InfoPosts[c.Title]) == 0 {
+		// 投稿していないものは取り消す必要がない
+		slog.Info("Skip cancellation of unknown earthquake information", slog.Any("sink", r.Name), slog.Any("eventId", c.EventId), slog.Any("title", c.Title))
+		return nil
+	}
+	ref, err := r.retractPosts(ctx, m, t, t.InfoPosts[c.Title])
+	if err != nil {
+		return err
+	}
+	delete(t.InfoPosts, c.Title)
+	// 取消より前の報は投稿しない
+	t.InfoSerials[c.Title] = max(t.InfoSerials[c.Title], int(c.Serial))
+	r.save(key, t, ref)
+	return nil
+}
+
+// tsunami は津波の電文を投稿する。同じEventIDのスレッドがあれば返信する
+func (r *Runner) tsunami(ctx context.Context, m Message, key string, t *Thread, found bool) error {
+	c := m.Content
+	switch {
+	case found && t.Canceled:
+		slog.Info("Skip canceled event", slog.Any("sink", r.Name), slog.Any("thread", t))
+		return nil
+	case c.IsCanceled():
+		return r.retractTsunami(ctx, m, key, t, found)
+	case found && !c.ReportDateTime.After(t.TsunamiReports[c.Title]):
+		slog.Info("Skip old report", slog.Any("sink", r.Name), slog.Any("title", c.Title), slog.Any("reportDateTime", c.ReportDateTime), slog.Any("thread", t))
+		return nil
+	case !found && !r.Policy.Allow(c, nil):
+		slog.Info("Skip by policy", slog.Any("sink", r.Name), slog.Any("eventId", c.EventId), slog.Any("title", c.Title))
+		return nil
+	}
+
+	var ref Ref
+	var err error
+	if found {
+		ref, err = r.Publisher.Reply(ctx, m, t)
+		if err != nil {
+			return fmt.Errorf("failed to reply: %w", err)
+		}
+	} else {
+		ref, err = r.Publisher.Post(ctx, m)
+		if err != nil {
+			return fmt.Errorf("failed to post: %w", err)
+		}
+		*t = Thread{
+			EventId: c.EventId,
+			Root:    ref,
+		}
+	}
+	slog.Info("Succeed to post", slog.Any("sink", r.Name), slog.Any("ref", ref), slog.Any("text", m.Text))
+
+	if t.TsunamiReports == nil {
+		t.TsunamiReports = make(map[string]time.Time)
+	}
+	t.TsunamiReports[c.Title] = c.ReportDateTime
+	t.TsunamiPosts = append(t.TsunamiPosts, ref)
+	r.save(key, t, ref)
+	return nil
+}
+
+// retractTsunami は津波の取消を投稿し、これまでの津波の投稿だけを削除する。
+// 緊急地震速報や地震情報の投稿は残し、スレッドも取消済みにしない
+func (r *Runner) retractTsunami(ctx context.Context, m Message, key string, t *Thread, found bool) error {
+	c := m.Content
+	if !found || len(t.TsunamiPosts) == 0 {
+		// 投稿していないものは取り消す必要がない
+		slog.Info("Skip cancellation of unknown tsunami", slog.Any("sink", r.Name), slog.Any("eventId", c.EventId), slog.Any("title", c.Title))
+		return nil
+	}
+	ref, err := r.retractPosts(ctx, m, t, t.TsunamiPosts)
+	if err != nil {
+		return err
+	}
+	t.TsunamiPosts = nil
+	// 取消より後に発表されたものは改めて投稿する
+	for title := range t.TsunamiReports {
+		t.TsunamiReports[title] = c.ReportDateTime
+	}
+	r.save(key, t, ref)
+	return nil
+}
+
+// retractPosts はスレッドの投稿のうちpostsだけを取り消す。取消は削除しない最後の投稿に返信する
+func (r *Runner) retractPosts(ctx context.Context, m Message, t *Thread, posts []Ref) (Ref, error) {
+	retracted := *t
+	retracted.Last = t.Root
+	for _, p := range t.Posts {
+		if !slices.Contains(posts, p) {
+			retracted.Last = p
+		}
+	}
+	retracted.Posts = posts
+	ref, err := r.Publisher.Retract(ctx, m, &retracted)
+	if err != nil {
+		return ref, fmt.Errorf("failed to retract: %w", err)
+	}
+	slog.Info("Succeed to post", slog.Any("sink", r.Name), slog.Any("ref", ref), slog.Any("text", m.Text))
+
+	deleted := retracted.Deletable()
+	kept := t.Posts[:0:0]
+	for _, p := range t.Posts {
+		if !slices.Contains(deleted, p) {
+			kept = append(kept, p)
+		}
+	}
+	t.Posts = kept
+	return ref, nil
+}
+
+// Deletable は取消時に削除する投稿。スレッドが残るよう最初の投稿と取消の返信先は除く
+func (t *Thread) Deletable() []Ref {
+	var refs []Ref
+	for _, p := range t.Posts {
+		if p != t.Root && p != t.Last {
+			refs = append(refs, p)
+		}
+	}
+	return refs
+}
+
+// save は投稿したrefをスレッドに加えて保存する
+func (r *Runner) save(key string, t *Thread, ref Ref) {
+	t.Last = ref
+	t.Posts = append(t.Posts, ref)
+	t.ExpiresAt = time.Now().Add(state.DefaultTTL)
+	if err := r.Store.Save(key, *t, t.ExpiresAt); err != nil {
+		slog.Error("Failed to save state", err, slog.Any("sink", r.Name), slog.Any("key", key))
+	}
+}
@@ -0,0 +1,399 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/matsuu/namazu/eew"
+	"github.com/matsuu/namazu/state"
+)
+
+type fakePublisher struct {
+	posts  []string
+	langs  []eew.Language
+	images []*Image
+	n      int
+}
+
+func (p *fakePublisher) ref(m Message) Ref {
+	p.langs = append(p.langs, m.Language)
+	p.images = append(p.images, m.Image)
+	p.n++
+	return Ref{Id: fmt.Sprint(p.n)}
+}
+
+func (p *fakePublisher) Post(ctx context.Context, m Message) (Ref, error) {
+	p.posts = append(p.posts, "post")
+	return p.ref(m), nil
+}
+
+func (p *fakePublisher) Reply(ctx context.Context, m Message, t *Thread) (Ref, error) {
+	p.posts = append(p.posts, "reply:"+t.Last.Id)
+	return p.ref(m), nil
+}
+
+func (p *fakePublisher) Retract(ctx context.Context, m Message, t *Thread) (Ref, error) {
+	p.posts = append(p.posts, fmt.Sprintf("retract:%s:%d", t.Last.Id, len(t.Deletable())))
+	return p.ref(m), nil
+}
+
+func readTelegram(t *testing.T, file string, serial int) *eew.Telegram {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to open sample xml: %v", err)
+	}
+	re := regexp.MustCompile(`<Serial>\d+</Serial>`)
+	b = re.ReplaceAll(b, []byte(fmt.Sprintf("<Serial>%d</Serial>", serial)))
+	return &eew.Telegram{Type: "VXSE45", Body: b}
+}
+
+// readCanceled はfileの電文をreportDateTimeに発表された報数serialの取消報にする
+func readCanceled(t *testing.T, file string, serial int, reportDateTime string) *eew.Telegram {
+	t.Helper()
+	tg := readTelegram(t, file, serial)
+	b := bytes.Replace(tg.Body, []byte("<InfoType>発表</InfoType>"), []byte("<InfoType>取消</InfoType>"), 1)
+	re := regexp.MustCompile(`<ReportDateTime>[^<]+</ReportDateTime>`)
+	tg.Body = re.ReplaceAll(b, []byte("<ReportDateTime>"+reportDateTime+"</ReportDateTime>"))
+	return tg
+}
+
+const (
+	report  = "../eew/samples/77_01_01_110311_VXSE45.xml"
+	cancel  = "../eew/samples/77_01_02_110311_VXSE45.xml"
+	warning = "../eew/samples/77_01_01_110311_VXSE43.xml"
+	shindo  = "../eew/samples/77_01_03_110311_VXSE51.xml"
+	shingen = "../eew/samples/77_01_04_110311_VXSE52.xml"
+	jishin  = "../eew/samples/77_01_05_110311_VXSE53.xml"
+	tsunami = "../eew/samples/77_01_06_110311_VTSE41.xml"
+	tinfo   = "../eew/samples/77_01_07_110311_VTSE51.xml"
+)
+
+func TestRunner(t *testing.T) {
+	tests := []struct {
+		Policy Policy
+		Want   []string
+	}{
+		{
+			// 取消は最初の投稿に返信し、続報だけを削除する
+			Policy: Policy{Reports: ReportsAll},
+			Want:   []string{"post", "reply:1", "retract:1:1"},
+		},
+		{
+			// 最終報ではないので続報は投稿されない
+			Policy: Policy{Reports: ReportsFirstLast},
+			Want:   []string{"post", "retract:1:0"},
+		},
+	}
+	for _, tt := range tests {
+		p := &fakePublisher{}
+		r := Runner{
+			Name:      "test",
+			Publisher: p,
+			Store:     state.NewMemoryStore(),
+			Training:  TrainingDrop,
+			Policy:    tt.Policy,
+		}
+		ctx := context.Background()
+		for _, tg := range []*eew.Telegram{
+			readTelegram(t, report, 1),
+			readTelegram(t, report, 2),
+			// 同じ報は無視される
+			readTelegram(t, report, 2),
+			readTelegram(t, cancel, 2),
+			// 取消後は投稿しない
+			readTelegram(t, report, 3),
+		} {
+			if err := r.Handle(ctx, tg); err != nil {
+				t.Fatalf("failed to handle: %v", err)
+			}
+		}
+		if fmt.Sprint(p.posts) != fmt.Sprint(tt.Want) {
+			t.Errorf("%+v: got:%v want:%v", tt.Policy, p.posts, tt.Want)
+		}
+	}
+}
+
+func TestDeletable(t *testing.T) {
+	th := Thread{
+		Root:  Ref{Id: "1"},
+		Last:  Ref{Id: "3"},
+		Posts: []Ref{{Id: "1"}, {Id: "2"}, {Id: "3"}, {Id: "4"}},
+	}
+	// 最初の投稿と返信先は残す
+	if got, want := th.Deletable(), []Ref{{Id: "2"}, {Id: "4"}}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", got, want)
+	}
+}
+
+func TestRunnerLanguages(t *testing.T) {
+	ja, err := eew.NewRenderer("", eew.LanguageJapanese)
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	en, err := eew.NewRenderer("", eew.LanguageEnglish)
+	if err != nil {
+		t.Fatalf("failed to create renderer: %v", err)
+	}
+	p := &fakePublisher{}
+	r := Runner{
+		Name:      "test",
+		Publisher: p,
+		Store:     state.NewMemoryStore(),
+		Training:  TrainingDrop,
+		Policy:    Policy{Reports: ReportsAll},
+		Renderers: []*eew.Renderer{ja, en},
+	}
+	ctx := context.Background()
+	for _, tg := range []*eew.Telegram{
+		readTelegram(t, report, 1),
+		readTelegram(t, report, 2),
+		readTelegram(t, cancel, 2),
+	} {
+		if err := r.Handle(ctx, tg); err != nil {
+			t.Fatalf("failed to handle: %v", err)
+		}
+	}
+	// 言語ごとに別のスレッドになる
+	want := []string{"post", "post", "reply:1", "reply:2", "retract:1:1", "retract:2:1"}
+	if fmt.Sprint(p.posts) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", p.posts, want)
+	}
+	wantLangs := []eew.Language{"ja", "en", "ja", "en", "ja", "en"}
+	if fmt.Sprint(p.langs) != fmt.Sprint(wantLangs) {
+		t.Errorf("languages got:%v want:%v", p.langs, wantLangs)
+	}
+}
+
+func TestRunnerMap(t *testing.T) {
+	for _, attach := range []bool{false, true} {
+		p := &fakePublisher{}
+		r := Runner{
+			Name:      "test",
+			Publisher: p,
+			Store:     state.NewMemoryStore(),
+			Training:  TrainingDrop,
+			Policy:    Policy{Reports: ReportsAll},
+			Map:       attach,
+		}
+		ctx := context.Background()
+		for _, tg := range []*eew.Telegram{
+			readTelegram(t, report, 1),
+			// 取消報には地図を付けない
+			readTelegram(t, cancel, 1),
+		} {
+			if err := r.Handle(ctx, tg); err != nil {
+				t.Fatalf("failed to handle: %v", err)
+			}
+		}
+		if len(p.images) != 2 {
+			t.Fatalf("map:%v got:%d posts want:2", attach, len(p.images))
+		}
+		if img := p.images[0]; (img != nil) != attach {
+			t.Errorf("map:%v got:%v", attach, img)
+		} else if img != nil && (img.MimeType != "image/png" || len(img.Data) == 0 || !strings.Contains(img.Alt, "震央")) {
+			t.Errorf("map:%v got:%s %d bytes %q", attach, img.MimeType, len(img.Data), img.Alt)
+		}
+		if img := p.images[1]; img != nil {
+			t.Errorf("map:%v cancel got:%v", attach, img)
+		}
+	}
+}
+
+func TestRunnerWarning(t *testing.T) {
+	p := &fakePublisher{}
+	r := Runner{
+		Name:      "test",
+		Publisher: p,
+		Store:     state.NewMemoryStore(),
+		Training:  TrainingDrop,
+		Policy:    Policy{Reports: ReportsFirstLast, MinIntensity: "7"},
+	}
+	ctx := context.Background()
+	for _, tg := range []*eew.Telegram{
+		// 閾値に達しない予報は投稿しない
+		readTelegram(t, report, 1),
+		// 警報は閾値にかかわらず投稿する
+		readTelegram(t, warning, 2),
+		// 同じ報数の予報はReportsに従う
+		readTelegram(t, report, 2),
+		readTelegram(t, warning, 2),
+		// 警報の続報はすべて投稿する
+		readTelegram(t, warning, 3),
+	} {
+		if err := r.Handle(ctx, tg); err != nil {
+			t.Fatalf("failed to handle: %v", err)
+		}
+	}
+	if want := []string{"post", "reply:1"}; fmt.Sprint(p.posts) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", p.posts, want)
+	}
+}
+
+func TestRunnerFollowUp(t *testing.T) {
+	p := &fakePublisher{}
+	r := Runner{
+		Name:      "test",
+		Publisher: p,
+		Store:     state.NewMemoryStore(),
+		Training:  TrainingDrop,
+		Policy:    Policy{Reports: ReportsFirstLast},
+	}
+	ctx := context.Background()
+	for _, tg := range []*eew.Telegram{
+		// スレッドがなければ投稿しない
+		readTelegram(t, shindo, 1),
+		readTelegram(t, report, 1),
+		// 地震情報はReportsにかかわらずスレッドへ返信する
+		readTelegram(t, shindo, 1),
+		readTelegram(t, shindo, 1),
+		readTelegram(t, shingen, 1),
+		readTelegram(t, jishin, 1),
+		readTelegram(t, jishin, 2),
+	} {
+		if err := r.Handle(ctx, tg); err != nil {
+			t.Fatalf("failed to handle: %v", err)
+		}
+	}
+	if want := []string{"post", "reply:1", "reply:2", "reply:3", "reply:4"}; fmt.Sprint(p.posts) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", p.posts, want)
+	}
+}
+
+func TestRunnerFollowUpCanceled(t *testing.T) {
+	p := &fakePublisher{}
+	r := Runner{
+		Name:      "test",
+		Publisher: p,
+		Store:     state.NewMemoryStore(),
+		Training:  TrainingDrop,
+		Policy:    Policy{Reports: ReportsAll},
+	}
+	ctx := context.Background()
+	for _, tg := range []*eew.Telegram{
+		readTelegram(t, report, 1),
+		readTelegram(t, shindo, 1),
+		readTelegram(t, jishin, 1),
+		readTelegram(t, jishin, 2),
+		// 震源・震度に関する情報の投稿だけを削除し、取消は残る震度速報に返信する
+		readCanceled(t, jishin, 3, "2011-03-11T15:00:00+09:00"),
+		// 取消より前の報は投稿しない
+		readTelegram(t, jishin, 2),
+		// 投稿していない地震情報の取消は投稿しない
+		readCanceled(t, shingen, 1, "2011-03-11T15:00:00+09:00"),
+		// 緊急地震速報のスレッドは続く
+		readTelegram(t, report, 2),
+	} {
+		if err := r.Handle(ctx, tg); err != nil {
+			t.Fatalf("failed to handle: %v", err)
+		}
+	}
+	if want := []string{"post", "reply:1", "reply:2", "reply:3", "retract:2:2", "reply:5"}; fmt.Sprint(p.posts) != fmt.Sprint(want) {
+		t.Errorf("got:%v want:%v", p.posts, want)
+	}
+}
+
+func TestRunnerTsunami(t *testing.T) {
+	tests := []struct {
+		Name string
+		// 空ならReportsFirstLast
+		Reports   Reports
+		Telegrams []*eew.Telegram
+		Want      []string
+	}{
+		{
+			Name: "without thread",
+			Telegrams: []*eew.Telegram{
+				// 津波警報はスレッドがなくても投稿する
+				readTelegram(t, tsunami, 0),
+				// 同じ発表時刻の電文は無視される
+				readTelegram(t, tsunami, 0),
+				readTelegram(t, tinfo, 0),
+			},
+			Want: []string{"post", "reply:1"},
+		},
+		{
+			Name: "with thread",
+			Telegrams: []*eew.Telegram{
+				readTelegram(t, report, 1),
+				// 緊急地震速報のスレッドへ返信する
+				readTelegram(t, tsunami, 0),
+				readTelegram(t, tinfo, 0),
+			},
+			Want: []string{"post", "reply:1", "reply:2"},
+		},
+		{
+			Name: "canceled",
+			Telegrams: []*eew.Telegram{
+				readTelegram(t, report, 1),
+				readTelegram(t, cancel, 1),
+				readTelegram(t, tsunami, 0),
+			},
+			Want: []string{"post", "retract:1:0"},
+		},
+		{
+			Name:    "tsunami canceled",
+			Reports: ReportsAll,
+			Telegrams: []*eew.Telegram{
+				readTelegram(t, report, 1),
+				readTelegram(t, tsunami, 0),
+				readTelegram(t, tinfo, 0),
+				// 津波の投稿だけを削除し、取消は残る緊急地震速報に返信する
+				readCanceled(t, tsunami, 0, "2011-03-11T15:40:00+09:00"),
+				// 取消より前の発表は投稿しない
+				readTelegram(t, tinfo, 0),
+				// 緊急地震速報のスレッドは続く
+				readTelegram(t, report, 2),
+			},
+			Want: []string{"post", "reply:1", "reply:2", "retract:1:2", "reply:4"},
+		},
+		{
+			Name: "tsunami thread canceled",
+			Telegrams: []*eew.Telegram{
+				readTelegram(t, tsunami, 0),
+				readTelegram(t, tinfo, 0),
+				// 最初の投稿は残して返信する
+				readCanceled(t, tsunami, 0, "2011-03-11T15:40:00+09:00"),
+			},
+			Want: []string{"post", "reply:1", "retract:1:1"},
+		},
+		{
+			Name: "unknown tsunami canceled",
+			Telegrams: []*eew.Telegram{
+				// 投稿していない津波の取消は投稿しない
+				readCanceled(t, tsunami, 0, "2011-03-11T15:30:00+09:00"),
+				readTelegram(t, report, 1),
+				readCanceled(t, tsunami, 0, "2011-03-11T15:30:00+09:00"),
+			},
+			Want: []string{"post"},
+		},
+	}
+	for _, tt := range tests {
+		p := &fakePublisher{}
+		reports := tt.Reports
+		if reports == "" {
+			reports = ReportsFirstLast
+		}
+		r := Runner{
+			Name:      "test",
+			Publisher: p,
+			Store:     state.NewMemoryStore(),
+			Training:  TrainingDrop,
+			Policy:    Policy{Reports: reports},
+		}
+		ctx := context.Background()
+		for _, tg := range tt.Telegrams {
+			if err := r.Handle(ctx, tg); err != nil {
+				t.Fatalf("failed to handle: %v", err)
+			}
+		}
+		if fmt.Sprint(p.posts) != fmt.Sprint(tt.Want) {
+			t.Errorf("%s: got:%v want:%v", tt.Name, p.posts, tt.Want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"fmt"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+// TrainingMode は訓練・試験電文の扱い
+type TrainingMode string
+
+const (
+	// 訓練・試験電文は投稿しない
+	TrainingDrop TrainingMode = "drop"
+	// 訓練・試験電文だけを投稿する。試験用アカウント向け
+	TrainingOnly TrainingMode = "only"
+	// 訓練・試験電文に【訓練】などを付けて投稿する
+	TrainingPrefix TrainingMode = "prefix"
+)
+
+const DefaultTrainingMode = TrainingDrop
+
+func ParseTrainingMode(s string) (TrainingMode, error) {
+	switch m := TrainingMode(s); m {
+	case TrainingDrop, TrainingOnly, TrainingPrefix:
+		return m, nil
+	case "":
+		return DefaultTrainingMode, nil
+	}
+	return "", fmt.Errorf("unknown training mode: %s", s)
+}
+
+// Allow は電文を投稿するかと、訓練・試験であることを示すかを返す
+func (m TrainingMode) Allow(c *eew.Content) (ok, label bool) {
+	if !c.IsTraining() {
+		return m != TrainingOnly, false
+	}
+	switch m {
+	case TrainingOnly:
+		return true, false
+	case TrainingPrefix:
+		// 【訓練】などはtrainingテンプレートで付ける
+		return true, true
+	}
+	return false, false
+}
@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matsuu/namazu/eew"
+)
+
+func TestTrainingMode(t *testing.T) {
+	normal := &eew.Content{Status: eew.StatusNormal}
+	training := &eew.Content{Status: eew.StatusTraining}
+	test := &eew.Content{Status: eew.StatusNormal, Test: true}
+
+	type data struct {
+		Mode    TrainingMode
+		Content *eew.Content
+		Ok      bool
+		Label   bool
+	}
+	tests := []data{
+		{TrainingDrop, normal, true, false},
+		{TrainingDrop, training, false, false},
+		{TrainingDrop, test, false, false},
+		{TrainingOnly, normal, false, false},
+		{TrainingOnly, training, true, false},
+		{TrainingPrefix, normal, true, false},
+		{TrainingPrefix, training, true, true},
+		{TrainingPrefix, test, true, true},
+	}
+	for _, d := range tests {
+		ok, label := d.Mode.Allow(d.Content)
+		if ok != d.Ok || label != d.Label {
+			t.Errorf("%s %+v: got:%v,%v want:%v,%v", d.Mode, d.Content, ok, label, d.Ok, d.Label)
+		}
+	}
+}
+
+func TestTrainingLabel(t *testing.T) {
+	tests := []struct {
+		Content *eew.Content
+		Want    string
+	}{
+		{&eew.Content{Status: eew.StatusTraining, InfoType: eew.InfoTypeCancel, Serial: 1}, "【訓練】**緊急地震速報（予報）** 第1報 *取消*"},
+		{&eew.Content{Status: eew.StatusNormal, Test: true, InfoType: eew.InfoTypeCancel, Serial: 1}, "【試験】**緊急地震速報（予報）** 第1報 *取消*"},
+	}
+	for _, tt := range tests {
+		got, err := eew.DefaultRenderer.Render(tt.Content, true)
+		if err != nil {
+			t.Fatalf("failed to render: %v", err)
+		}
+		if !strings.HasPrefix(got, tt.Want) {
+			t.Errorf("got:%q want prefix:%q", got, tt.Want)
+		}
+	}
+}
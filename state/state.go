@@ -0,0 +1,224 @@
+// Package state はSNSへの投稿状態（スレッドの返信先など）を保存する
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultTTL は投稿状態を保持する期間
+const DefaultTTL = 24 * time.Hour
+
+// Store はキーごとに値を有効期限付きで保存する
+type Store interface {
+	// Load はkeyの値をvに読み込む。存在しないか期限切れならfalseを返す
+	Load(key string, v any) (bool, error)
+	Save(key string, v any, expiresAt time.Time) error
+	Delete(key string) error
+	// Expire は期限切れの値を削除する
+	Expire(now time.Time) error
+}
+
+type entry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+}
+
+// FileStore はJSONファイルに保存するStore
+// pathが空の場合はメモリ上にのみ保持する。
+// 複数のプロセスが同じファイルを使えるよう、書き込み時はロックして読み直し、変更したキーだけを反映する
+type FileStore struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]entry
+	// 前回の書き込みから保存または削除したキー
+	dirty map[string]bool
+}
+
+func NewMemoryStore() *FileStore {
+	return &FileStore{
+		entries: make(map[string]entry),
+		dirty:   make(map[string]bool),
+	}
+}
+
+// NewFileStore はpathから状態を読み込む。ファイルがなければ空の状態から始める
+func NewFileStore(path string) (*FileStore, error) {
+	s := NewMemoryStore()
+	s.path = path
+	if path == "" {
+		return s, nil
+	}
+	entries, err := readEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	s.entries = entries
+	return s, nil
+}
+
+// readEntries はpathの状態を読み込む。ファイルがなければ空
+func readEntries(path string) (map[string]entry, error) {
+	entries := make(map[string]entry)
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *FileStore) Load(key string, v any) (bool, error) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	s.mu.Unlock()
+	if !ok || e.ExpiresAt.Before(time.Now()) {
+		return false, nil
+	}
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *FileStore) Save(key string, v any, expiresAt time.Time) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry{
+		Value:     b,
+		ExpiresAt: expiresAt,
+	}
+	s.dirty[key] = true
+	return s.flush()
+}
+
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	s.dirty[key] = true
+	return s.flush()
+}
+
+func (s *FileStore) Expire(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.entries)
+	for k, e := range s.entries {
+		if e.ExpiresAt.Before(now) {
+			delete(s.entries, k)
+			s.dirty[k] = true
+		}
+	}
+	if n == len(s.entries) {
+		return nil
+	}
+	return s.flush()
+}
+
+// lockTimeout はロックを待つ時間。これより古いロックファイルは異常終了の残りとみなす
+const lockTimeout = 10 * time.Second
+
+// lock はpathに対応するロックファイルを作ってロックする。Windowsでも使えるようflockは使わない
+func lock(path string) (func(), error) {
+	name := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(name); err == nil && time.Since(fi.ModTime()) > lockTimeout {
+			slog.Warn("Remove stale lock file", slog.Any("path", name))
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout to lock %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// flush はファイルを読み直して変更したキーだけを反映し、他のプロセスが保存したものは残す。
+// 一時ファイルに書いてからrenameすることで書きかけの状態を残さない
+func (s *FileStore) flush() error {
+	if s.path == "" {
+		clear(s.dirty)
+		return nil
+	}
+	unlock, err := lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := readEntries(s.path)
+	if err != nil {
+		return err
+	}
+	for k := range s.dirty {
+		if e, ok := s.entries[k]; ok {
+			entries[k] = e
+		} else {
+			delete(entries, k)
+		}
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.entries = entries
+	clear(s.dirty)
+	return nil
+}
+
+// RunExpire はctxがキャンセルされるまで定期的に期限切れの値を削除する
+func RunExpire(ctx context.Context, s Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Expire(now); err != nil {
+				slog.Error("Failed to expire state", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type value struct {
+	Id     string
+	Serial int
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	now := time.Now()
+	if err := s.Save("mastodon:1", value{"a", 1}, now.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := s.Save("mastodon:2", value{"b", 2}, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	// 再起動を想定して読み直す
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	var got value
+	if ok, err := s.Load("mastodon:1", &got); err != nil || !ok {
+		t.Fatalf("failed to load: %v %v", ok, err)
+	}
+	if want := (value{"a", 1}); got != want {
+		t.Errorf("got:%v want:%v", got, want)
+	}
+	if ok, _ := s.Load("mastodon:2", &got); ok {
+		t.Errorf("expired value is loaded")
+	}
+
+	if err := s.Expire(now); err != nil {
+		t.Fatalf("failed to expire: %v", err)
+	}
+	if _, ok := s.entries["mastodon:2"]; ok {
+		t.Errorf("expired value is not deleted")
+	}
+	if err := s.Delete("mastodon:1"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	s, _ = NewFileStore(path)
+	if len(s.entries) != 0 {
+		t.Errorf("entries remain: %v", s.entries)
+	}
+}
+
+// 同じファイルを使う2つのプロセスが互いの状態を消さない
+func TestFileStoreShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	a, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	b, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	if err := a.Save("mastodon:1", value{"a", 1}, expiresAt); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := b.Save("bluesky:1", value{"b", 1}, expiresAt); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := a.Save("mastodon:1", value{"a", 2}, expiresAt); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	if err := b.Delete("bluesky:1"); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := b.Save("bluesky:2", value{"b", 2}, expiresAt); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	// 再起動を想定して読み直す
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	for key, want := range map[string]value{
+		"mastodon:1": {"a", 2},
+		"bluesky:2":  {"b", 2},
+	} {
+		var got value
+		if ok, err := s.Load(key, &got); err != nil || !ok {
+			t.Errorf("%s: failed to load: %v %v", key, ok, err)
+		} else if got != want {
+			t.Errorf("%s: got:%v want:%v", key, got, want)
+		}
+	}
+	if ok, _ := s.Load("bluesky:1", &value{}); ok {
+		t.Errorf("deleted value is loaded")
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file remains: %v", err)
+	}
+}